@@ -8,7 +8,12 @@ import (
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/docs"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/middleware"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/payments"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/privacy"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/routes"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/storage"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
@@ -41,13 +46,45 @@ func main() {
 	}
 	_ = db // just to show it’s connected
 
+	// Make sure default roles and permissions exist
+	if err := repository.SeedRolesAndPermissions(); err != nil {
+		log.Fatal("Seeding roles failed:", err)
+	}
+	// The audit log must stay append-only
+	if err := repository.EnsureAuditLogAppendOnly(); err != nil {
+		log.Fatal("Protecting the audit log failed:", err)
+	}
+	if env.BootstrapAdminEmail != "" {
+		if err := repository.BootstrapAdmin(env.BootstrapAdminEmail); err != nil {
+			log.Println("Admin bootstrap skipped:", err)
+		}
+	}
+
+	// A format too long for the order_number column would break every checkout
+	if err := utils.ValidateOrderNumberFormat(utils.GetOrderNumberFormat()); err != nil {
+		log.Fatal("Invalid order number format:", err)
+	}
+
+	// Signing keys are loaded once, not per request
+	if err := utils.InitJWT(env); err != nil {
+		log.Fatal("Loading JWT keys failed:", err)
+	}
+
 	// Connect to Redis
 	config.ConnectRedis()
 
+	// Pick up data exports interrupted by the last shutdown
+	if err := privacy.Resume(); err != nil {
+		log.Println("Resuming data exports failed:", err)
+	}
+	// and refunds that never got the provider's answer
+	payments.ResumeRefunds()
+
 	var router *gin.Engine = gin.Default()
 	//router := gin.Default()
 
 	// router.SetTrustedProxies(nil)
+	router.Use(middleware.RequestIDMiddleware())
 	router.Use(middleware.CORSMiddleware())
 	router.GET("/", func(ctx *gin.Context) {
 		fmt.Println("go working")
@@ -57,6 +94,11 @@ func main() {
 		})
 	})
 
+	// Files uploaded with the local storage backend
+	if env.StorageDriver == "" || env.StorageDriver == storage.LocalBackendName {
+		router.Static(storage.LocalURLPrefix, storage.NewLocalBackend().Root())
+	}
+
 	// Call SetRoutes to register all API routes
 	routes.SetRoutes(router)
 
@@ -3,6 +3,8 @@ package config
 import (
 	"log"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,22 +13,171 @@ type EnvConfig struct {
 	DatabaseUrl string
 	Port        string
 	Migrations  string
-	JWTSecret   string
+
+	// JWT signing keys, see utils.InitJWT
+	JWTKeysDir        string
+	JWTKeySchedule    string
+	JWTKeyGracePeriod string
+
+	// token lifetimes as Go durations, e.g. "15m", "720h"
+	AccessTokenTTL  string
+	RefreshTokenTTL string
+
+	// IdempotencyTTL is how long an Idempotency-Key is remembered, e.g. "24h"
+	IdempotencyTTL string
+
+	// order number format, see utils.OrderNumberFormat
+	OrderNumberPrefix     string
+	OrderNumberDateLayout string
+	OrderNumberSeqDigits  string
+
+	// PaymentProvider selects the payment gateway, "mock" when empty
+	PaymentProvider string
+	// PaymentWebhookSecret signs inbound provider webhooks (HMAC-SHA256)
+	PaymentWebhookSecret string
+
+	// ReturnWindowDays is how long after delivery items can be returned
+	ReturnWindowDays string
+
+	// MailDriver picks the mailer ("console" or "file", console when empty), MailDir is where the file mailer writes
+	MailDriver string
+	MailDir    string
+	MailFrom   string
+
+	// PasswordResetURL is the frontend page the reset token is appended to
+	PasswordResetURL string
+	PasswordResetTTL string
+
+	// EmailVerificationURL is the frontend page the verification token is appended to
+	EmailVerificationURL string
+	EmailVerificationTTL string
+	// RequireVerifiedEmail blocks checkout for accounts that haven't confirmed their email ("true"/"false")
+	RequireVerifiedEmail string
+	// RequireShippingAddress rejects checkout for users without a shipping address ("true"/"false", default false)
+	RequireShippingAddress string
+
+	// MFASecretKey encrypts stored TOTP secrets, TOTPIssuer is the name shown in authenticator apps
+	MFASecretKey string
+	TOTPIssuer   string
+
+	// login throttling: failures before an email is locked, failures allowed per IP, and lockout length
+	LoginMaxFailures     string
+	LoginIPMaxFailures   string
+	LoginLockoutDuration string
+	// AuditHashKey keys the hash audit entries keep instead of an email that belongs to no account
+	AuditHashKey string
+
+	// OIDCProviders lists the identity providers, see oidc.ProviderConfig for their settings
+	OIDCProviders string
+
+	// StorageDriver picks where uploads go ("local" or "s3", local when empty)
+	StorageDriver   string
+	StorageLocalDir string
+	S3Bucket        string
+	S3PublicURL     string
+
+	// DataExportDir holds built data export archives, it must not be publicly served
+	DataExportDir string
+	DataExportTTL string
+
+	// ImpersonationTTL is how long an admin's impersonation token lasts (default 15m, at most the access token TTL)
+	ImpersonationTTL string
+
+	// BootstrapAdminEmail is made admin at startup while no admin exists
+	BootstrapAdminEmail string
 }
 
-// public
+var (
+	envConfig     *EnvConfig
+	envConfigOnce sync.Once
+)
+
+// LoadEnv reads .env and the environment on the first call and returns the same config
+// afterwards, so it's cheap to call from handlers.
 func LoadEnv() *EnvConfig {
+	envConfigOnce.Do(func() {
+		envConfig = readEnv()
+	})
+	return envConfig
+}
+
+func readEnv() *EnvConfig {
 	var err error = godotenv.Load()
 	if err != nil {
 		log.Println("Error loading .env file:", err)
 	}
-	var envConfig = &EnvConfig{
+	var cfg = &EnvConfig{
 		DatabaseUrl: os.Getenv("DB_URL"),
 		Port:        os.Getenv("PORT"),
 		Migrations:  os.Getenv("MIGRATIONS_DIR"),
-		JWTSecret:   os.Getenv("JWT_SECRET"),
+
+		JWTKeysDir:        os.Getenv("JWT_KEYS_DIR"),
+		JWTKeySchedule:    os.Getenv("JWT_KEY_SCHEDULE"),
+		JWTKeyGracePeriod: os.Getenv("JWT_KEY_GRACE_PERIOD"),
+
+		AccessTokenTTL:  os.Getenv("ACCESS_TOKEN_TTL"),
+		RefreshTokenTTL: os.Getenv("REFRESH_TOKEN_TTL"),
+
+		IdempotencyTTL: os.Getenv("IDEMPOTENCY_TTL"),
+
+		OrderNumberPrefix:     os.Getenv("ORDER_NUMBER_PREFIX"),
+		OrderNumberDateLayout: os.Getenv("ORDER_NUMBER_DATE_LAYOUT"),
+		OrderNumberSeqDigits:  os.Getenv("ORDER_NUMBER_SEQ_DIGITS"),
+
+		PaymentProvider:      os.Getenv("PAYMENT_PROVIDER"),
+		PaymentWebhookSecret: os.Getenv("PAYMENT_WEBHOOK_SECRET"),
+
+		ReturnWindowDays: os.Getenv("RETURN_WINDOW_DAYS"),
+
+		MailDriver: os.Getenv("MAIL_DRIVER"),
+		MailDir:    os.Getenv("MAIL_DIR"),
+		MailFrom:   os.Getenv("MAIL_FROM"),
+
+		PasswordResetURL: os.Getenv("PASSWORD_RESET_URL"),
+		PasswordResetTTL: os.Getenv("PASSWORD_RESET_TTL"),
+
+		EmailVerificationURL: os.Getenv("EMAIL_VERIFICATION_URL"),
+		EmailVerificationTTL: os.Getenv("EMAIL_VERIFICATION_TTL"),
+		RequireVerifiedEmail: os.Getenv("REQUIRE_VERIFIED_EMAIL"),
+
+		RequireShippingAddress: os.Getenv("REQUIRE_SHIPPING_ADDRESS"),
+
+		MFASecretKey: os.Getenv("MFA_SECRET_KEY"),
+		TOTPIssuer:   os.Getenv("TOTP_ISSUER"),
+
+		LoginMaxFailures:     os.Getenv("LOGIN_MAX_FAILURES"),
+		LoginIPMaxFailures:   os.Getenv("LOGIN_IP_MAX_FAILURES"),
+		LoginLockoutDuration: os.Getenv("LOGIN_LOCKOUT_DURATION"),
+		AuditHashKey:         os.Getenv("AUDIT_HASH_KEY"),
+
+		OIDCProviders: os.Getenv("OIDC_PROVIDERS"),
+
+		StorageDriver:   os.Getenv("STORAGE_DRIVER"),
+		StorageLocalDir: os.Getenv("STORAGE_LOCAL_DIR"),
+		S3Bucket:        os.Getenv("S3_BUCKET"),
+		S3PublicURL:     os.Getenv("S3_PUBLIC_URL"),
+
+		DataExportDir: os.Getenv("DATA_EXPORT_DIR"),
+		DataExportTTL: os.Getenv("DATA_EXPORT_TTL"),
+
+		ImpersonationTTL: os.Getenv("IMPERSONATION_TTL"),
+
+		BootstrapAdminEmail: os.Getenv("BOOTSTRAP_ADMIN_EMAIL"),
 	}
-	return envConfig
+	return cfg
+}
+
+// DurationOr parses a Go duration from env, falling back when it's empty or invalid
+func DurationOr(raw string, fallback time.Duration) time.Duration {
+	if raw == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		log.Printf("invalid duration %q, using %s", raw, fallback)
+		return fallback
+	}
+	return d
 }
 
 // private helper
@@ -152,12 +152,32 @@ func AutoMigrate(db *gorm.DB) error {
 
 	err := db.AutoMigrate(
 		&models.User{},
+		&models.Role{},
+		&models.Permission{},
+		&models.UserRole{},
+		&models.RefreshToken{},
+		&models.UserToken{},
+		&models.UserTOTP{},
+		&models.RecoveryCode{},
+		&models.APIKey{},
+		&models.UserIdentity{},
+		&models.UserAddress{},
+		&models.DataExport{},
+		&models.AuditLog{},
 		&models.Product{},
 		&models.ProductImages{},
 		&models.Cart{},
 		&models.CartItems{},
 		&models.Order{},
 		&models.OrderItem{},
+		&models.OrderStatusHistory{},
+		&models.Refund{},
+		&models.RefundItem{},
+		&models.Payment{},
+		&models.PaymentWebhookEvent{},
+		&models.ReturnRequest{},
+		&models.ReturnItem{},
+		&models.ReturnEvent{},
 	)
 
 	if err != nil {
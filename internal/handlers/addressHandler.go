@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+)
+
+// AddressRequest - request body for creating or replacing an address
+// @Description Address book entry
+type AddressRequest struct {
+	Label             string `json:"label" binding:"max=50" example:"Home"`
+	Recipient         string `json:"recipient" binding:"required,min=2,max=100" example:"John Doe"`
+	Phone             string `json:"phone" binding:"max=30" example:"+1 555 0100"`
+	Line1             string `json:"line1" binding:"required,max=200" example:"1 Main Street"`
+	Line2             string `json:"line2" binding:"max=200" example:"Apt 4"`
+	City              string `json:"city" binding:"required,max=100" example:"Springfield"`
+	Region            string `json:"region" binding:"max=100" example:"IL"`
+	PostalCode        string `json:"postal_code" binding:"max=20" example:"62701"`
+	Country           string `json:"country" binding:"required,len=2,alpha" example:"US"`
+	IsDefaultShipping bool   `json:"is_default_shipping"`
+	IsDefaultBilling  bool   `json:"is_default_billing"`
+}
+
+// toAddress validates the postal code for the country and builds the model
+func (r *AddressRequest) toAddress(userID uuid.UUID) (*models.UserAddress, error) {
+	country := strings.ToUpper(r.Country)
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		if err := v.Var(country, "iso3166_1_alpha2"); err != nil {
+			return nil, fmt.Errorf("unknown country code %q", r.Country)
+		}
+	}
+	postalCode := utils.NormalizePostalCode(r.PostalCode)
+	if err := utils.ValidatePostalCode(country, postalCode); err != nil {
+		return nil, err
+	}
+
+	return &models.UserAddress{
+		UserID:            userID,
+		Label:             strings.TrimSpace(r.Label),
+		Recipient:         strings.TrimSpace(r.Recipient),
+		Phone:             strings.TrimSpace(r.Phone),
+		Line1:             strings.TrimSpace(r.Line1),
+		Line2:             strings.TrimSpace(r.Line2),
+		City:              strings.TrimSpace(r.City),
+		Region:            strings.TrimSpace(r.Region),
+		PostalCode:        postalCode,
+		Country:           country,
+		IsDefaultShipping: r.IsDefaultShipping,
+		IsDefaultBilling:  r.IsDefaultBilling,
+	}, nil
+}
+
+// ListAddresses godoc
+// @Summary     List own addresses
+// @Description Address book of the logged in user, defaults first
+// @Tags        Addresses
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {array}   models.UserAddress
+// @Failure     401  {object}  map[string]interface{}
+// @Failure     500  {object}  map[string]interface{}
+// @Router      /users/me/addresses [get]
+func ListAddresses(c *gin.Context) {
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	addresses, err := repository.ListAddresses(userId)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", addresses)
+}
+
+// GetAddress godoc
+// @Summary     Get an address
+// @Tags        Addresses
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Address UUID"
+// @Success     200  {object}  models.UserAddress
+// @Failure     400  {object}  map[string]interface{}
+// @Failure     404  {object}  map[string]interface{}
+// @Router      /users/me/addresses/{id} [get]
+func GetAddress(c *gin.Context) {
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid address ID", nil)
+		return
+	}
+
+	address, err := repository.GetAddress(userId, id)
+	if err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "Address not found", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", address)
+}
+
+// CreateAddress godoc
+// @Summary     Add an address
+// @Description Add an address to the book. The first one becomes the default for shipping and billing.
+// @Tags        Addresses
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       body  body      AddressRequest  true  "Address"
+// @Success     201   {object}  models.UserAddress
+// @Failure     400   {object}  map[string]interface{}
+// @Failure     409   {object}  map[string]interface{}
+// @Failure     500   {object}  map[string]interface{}
+// @Router      /users/me/addresses [post]
+func CreateAddress(c *gin.Context) {
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	var req AddressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+	address, err := req.toAddress(userId)
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	if err := repository.CreateAddress(address); err != nil {
+		if errors.Is(err, repository.ErrAddressLimit) {
+			utils.ResponseError(c, http.StatusConflict, err.Error(), nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	utils.ResponseSuccess(c, http.StatusCreated, "address added successfully", address)
+}
+
+// UpdateAddress godoc
+// @Summary     Replace an address
+// @Description Orders already placed keep the address they were placed with
+// @Tags        Addresses
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id    path      string          true  "Address UUID"
+// @Param       body  body      AddressRequest  true  "Address"
+// @Success     200   {object}  models.UserAddress
+// @Failure     400   {object}  map[string]interface{}
+// @Failure     404   {object}  map[string]interface{}
+// @Failure     500   {object}  map[string]interface{}
+// @Router      /users/me/addresses/{id} [put]
+func UpdateAddress(c *gin.Context) {
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid address ID", nil)
+		return
+	}
+
+	var req AddressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+	address, err := req.toAddress(userId)
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+	address.ID = id
+
+	if err := repository.UpdateAddress(address); err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "Address not found", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "address updated successfully", address)
+}
+
+// DeleteAddress godoc
+// @Summary     Delete an address
+// @Description A deleted default is replaced by the most recently added remaining address
+// @Tags        Addresses
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Address UUID"
+// @Success     200  {object}  map[string]interface{}
+// @Failure     400  {object}  map[string]interface{}
+// @Failure     404  {object}  map[string]interface{}
+// @Failure     500  {object}  map[string]interface{}
+// @Router      /users/me/addresses/{id} [delete]
+func DeleteAddress(c *gin.Context) {
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid address ID", nil)
+		return
+	}
+
+	if err := repository.DeleteAddress(userId, id); err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "Address not found", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "address deleted successfully", nil)
+}
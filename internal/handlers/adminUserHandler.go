@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+)
+
+const defaultImpersonationTTL = 15 * time.Minute
+
+// AdminUserResponse is the admin console's view of an account
+// @Description User as seen by admins
+type AdminUserResponse struct {
+	utils.UserResponse
+	Suspended             bool       `json:"suspended"`
+	SuspendedAt           *time.Time `json:"suspended_at,omitempty"`
+	SuspendedReason       string     `json:"suspended_reason,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	CreatedAt             time.Time  `json:"created_at"`
+}
+
+func toAdminUserResponse(user *models.User) AdminUserResponse {
+	return AdminUserResponse{
+		UserResponse:          utils.ToUserResponse(user),
+		Suspended:             user.SuspendedAt != nil,
+		SuspendedAt:           user.SuspendedAt,
+		SuspendedReason:       user.SuspendedReason,
+		PasswordResetRequired: user.PasswordResetRequired,
+		CreatedAt:             user.CreatedAt,
+	}
+}
+
+// SuspendUserRequest - request body for suspending an account
+// @Description Suspension payload
+type SuspendUserRequest struct {
+	Reason string `json:"reason" binding:"required,min=3,max=500" example:"chargeback fraud"`
+}
+
+// ImpersonateUserRequest - request body for impersonating a user
+// @Description Impersonation payload, the reason is kept in the audit log
+type ImpersonateUserRequest struct {
+	Reason string `json:"reason" binding:"required,min=3,max=500" example:"ticket 4211: checkout fails"`
+}
+
+// adminTarget parses the acting admin and the :id user. On failure the response is already written.
+func adminTarget(c *gin.Context) (actorID uuid.UUID, userID uuid.UUID, ok bool) {
+	actorID, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return uuid.Nil, uuid.Nil, false
+	}
+	userID, err = uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid user ID", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+	return actorID, userID, true
+}
+
+func auditAdminAction(c *gin.Context, action string, userID uuid.UUID, metadata map[string]interface{}) {
+	recordAudit(c, action, models.AuditTargetUser, userID.String(), nil, nil, metadata)
+}
+
+// SuspendUser godoc
+// @Summary     Suspend a user (Admin)
+// @Description Block the account: logins fail and its tokens and API keys stop working at once
+// @Tags        Users
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id    path      string              true  "User UUID"
+// @Param       body  body      SuspendUserRequest  true  "Reason"
+// @Success     200   {object}  AdminUserResponse
+// @Failure     400   {object}  map[string]interface{}
+// @Failure     403   {object}  map[string]interface{}
+// @Failure     404   {object}  map[string]interface{}
+// @Failure     500   {object}  map[string]interface{}
+// @Router      /admin/users/{id}/suspend [post]
+func SuspendUser(c *gin.Context) {
+	actorId, userId, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+	if actorId == userId {
+		utils.ResponseError(c, http.StatusBadRequest, "you can't suspend yourself", nil)
+		return
+	}
+
+	var req SuspendUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	user, err := repository.SuspendUser(userId, req.Reason)
+	if err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "User not found", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	auditAdminAction(c, models.AuditUserSuspend, userId, map[string]interface{}{"reason": req.Reason})
+	if err := revokeAccessTokens(c.Request.Context(), userId); err != nil {
+		utils.ResponseError(c, http.StatusServiceUnavailable, "user suspended, but "+err.Error(), nil)
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "user suspended", toAdminUserResponse(user))
+}
+
+// ReactivateUser godoc
+// @Summary     Reactivate a user (Admin)
+// @Description Lift a suspension. The user has to log in again.
+// @Tags        Users
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "User UUID"
+// @Success     200  {object}  AdminUserResponse
+// @Failure     400  {object}  map[string]interface{}
+// @Failure     403  {object}  map[string]interface{}
+// @Failure     404  {object}  map[string]interface{}
+// @Failure     409  {object}  map[string]interface{}
+// @Failure     500  {object}  map[string]interface{}
+// @Router      /admin/users/{id}/reactivate [post]
+func ReactivateUser(c *gin.Context) {
+	_, userId, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	user, err := repository.ReactivateUser(userId)
+	if err != nil {
+		switch {
+		case utils.IsNotFound(err):
+			utils.ResponseError(c, http.StatusNotFound, "User not found", nil)
+		case errors.Is(err, repository.ErrUserNotSuspended):
+			utils.ResponseError(c, http.StatusConflict, err.Error(), nil)
+		default:
+			utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		}
+		return
+	}
+	auditAdminAction(c, models.AuditUserReactivate, userId, nil)
+
+	utils.ResponseSuccess(c, http.StatusOK, "user reactivated", toAdminUserResponse(user))
+}
+
+// ForcePasswordReset godoc
+// @Summary     Force a password reset (Admin)
+// @Description End every session of the user, revoke their API keys and stop the current password from working. A reset link is emailed; logging in with a password fails until it is used.
+// @Tags        Users
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "User UUID"
+// @Success     200  {object}  map[string]interface{}
+// @Failure     400  {object}  map[string]interface{}
+// @Failure     403  {object}  map[string]interface{}
+// @Failure     404  {object}  map[string]interface{}
+// @Failure     500  {object}  map[string]interface{}
+// @Router      /admin/users/{id}/password-reset [post]
+func ForcePasswordReset(c *gin.Context) {
+	_, userId, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	if err := repository.RequirePasswordReset(userId); err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "User not found", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	auditAdminAction(c, models.AuditPasswordResetForced, userId, nil)
+	if err := revokeAccessTokens(c.Request.Context(), userId); err != nil {
+		utils.ResponseError(c, http.StatusServiceUnavailable, "password reset required, but "+err.Error(), nil)
+		return
+	}
+
+	user, err := repository.GetUserByUUID(userId)
+	if err == nil {
+		err = mailPasswordResetLink(c.Request.Context(), user,
+			"For your security, our team has reset the password of your account.",
+			"Until you choose a new password you can't log in with the old one.")
+	}
+	if err != nil {
+		// the reset is in place, the user can still ask for a link themselves
+		log.Printf("forced password reset mail to %s failed: %v", userId, err)
+		utils.ResponseSuccess(c, http.StatusOK, "password reset required, but the email could not be sent", gin.H{"email_sent": false})
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "password reset required, reset link sent", gin.H{"email_sent": true})
+}
+
+// ImpersonateUser godoc
+// @Summary     Impersonate a user (Admin)
+// @Description Get a short-lived access token to act as the user, e.g. to reproduce a support issue. There is no refresh token. The token carries an "act" claim with the admin's id, responses to it have the X-Impersonated-By header, and every change made with it is audited. Credentials, API keys and personal data can't be changed with it. Only users whose permissions the admin also has can be impersonated.
+// @Tags        Users
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id    path      string                  true  "User UUID"
+// @Param       body  body      ImpersonateUserRequest  true  "Reason"
+// @Success     200   {object}  map[string]interface{}
+// @Failure     400   {object}  map[string]interface{}
+// @Failure     403   {object}  map[string]interface{}
+// @Failure     404   {object}  map[string]interface{}
+// @Failure     409   {object}  map[string]interface{}
+// @Failure     500   {object}  map[string]interface{}
+// @Router      /admin/users/{id}/impersonate [post]
+func ImpersonateUser(c *gin.Context) {
+	// an impersonation token is the admin's own session, not a key or another impersonation
+	if rejectDelegatedSession(c) {
+		return
+	}
+	actorId, userId, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+	if actorId == userId {
+		utils.ResponseError(c, http.StatusBadRequest, "you can't impersonate yourself", nil)
+		return
+	}
+
+	var req ImpersonateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	if err := repository.CheckAccountActive(userId); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrAccountUnavailable):
+			utils.ResponseError(c, http.StatusNotFound, "User not found", nil)
+		case errors.Is(err, repository.ErrAccountSuspended):
+			utils.ResponseError(c, http.StatusConflict, err.Error(), nil)
+		default:
+			utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		}
+		return
+	}
+
+	// acting as the user must not hand out anything the impersonator doesn't have already
+	targetPermissions, err := repository.GetUserPermissionNames(userId)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	actorPermissions, err := repository.GetUserPermissionNames(actorId)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	granted := make(map[string]bool, len(actorPermissions))
+	for _, p := range actorPermissions {
+		granted[p] = true
+	}
+	for _, p := range targetPermissions {
+		if !granted[p] {
+			utils.ResponseError(c, http.StatusForbidden, "the user has permissions you don't have", gin.H{"missing_permission": p})
+			return
+		}
+	}
+
+	roles, err := repository.GetUserRoleNames(userId)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	ttl := config.DurationOr(config.LoadEnv().ImpersonationTTL, defaultImpersonationTTL)
+	// the revocation cutoff only outlives tokens up to the access token TTL
+	if ttl > utils.AccessTokenTTL() {
+		ttl = utils.AccessTokenTTL()
+	}
+	claims := utils.NewAccessClaims(userId.String(), roles)
+	claims.ExpiresAt = jwt.NewNumericDate(claims.IssuedAt.Add(ttl))
+	claims.Actor = &utils.TokenActor{UserID: actorId.String()}
+	token, err := utils.CreateToken(claims)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "could not create token", nil)
+		return
+	}
+
+	auditAdminAction(c, models.AuditImpersonationStart, userId, map[string]interface{}{
+		"reason":     req.Reason,
+		"jti":        claims.ID,
+		"expires_at": claims.ExpiresAt.Time,
+	})
+
+	utils.ResponseSuccess(c, http.StatusOK, "impersonation started", gin.H{
+		"token":        token,
+		"token_type":   "Bearer",
+		"expires_in":   int(ttl.Seconds()),
+		"impersonated": true,
+		"user_id":      userId,
+	})
+}
+
+// UnlockUser godoc
+// @Summary     Unlock a user's login (Admin)
+// @Description Lift a lockout caused by failed logins and reset the failure counters
+// @Tags        Users
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "User UUID"
+// @Success     200  {object}  map[string]interface{}
+// @Failure     400  {object}  map[string]interface{}
+// @Failure     403  {object}  map[string]interface{}
+// @Failure     404  {object}  map[string]interface{}
+// @Failure     500  {object}  map[string]interface{}
+// @Router      /admin/users/{id}/unlock [post]
+func UnlockUser(c *gin.Context) {
+	if _, err := uuid.Parse(c.GetString("userId")); err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+	userId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	user, err := repository.GetUserByUUID(userId)
+	if err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "User not found", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+
+	if err := utils.UnlockLogin(c.Request.Context(), user.Email); err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	recordAudit(c, models.AuditLoginUnlock, models.AuditTargetUser, user.ID.String(), nil, nil, nil)
+
+	utils.ResponseSuccess(c, http.StatusOK, "user unlocked", utils.ToUserResponse(user))
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/middleware"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+)
+
+// CreateAPIKeyRequest - request body for a new API key
+// @Description API key payload
+type CreateAPIKeyRequest struct {
+	Name       string     `json:"name" binding:"required,max=100" example:"warehouse sync"`
+	Scopes     []string   `json:"scopes" binding:"required,min=1" example:"product:write"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	AllowedIPs []string   `json:"allowed_ips" example:"203.0.113.0/24"`
+}
+
+type APIKeyResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	AllowedIPs []string   `json:"allowed_ips"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func toAPIKeyResponse(key *models.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.ScopeList(),
+		AllowedIPs: key.AllowedIPList(),
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		LastUsedIP: key.LastUsedIP,
+		RevokedAt:  key.RevokedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+// rejectAPIKeySession keeps keys away from account and session management,
+// a leaked key must not be able to mint more keys or end the owner's sessions
+func rejectAPIKeySession(c *gin.Context) bool {
+	if middleware.GetAPIKey(c) != nil {
+		utils.ResponseError(c, http.StatusForbidden, "not allowed with an API key", nil)
+		return true
+	}
+	return false
+}
+
+// rejectDelegatedSession also refuses impersonation tokens: an admin acting as the user
+// must not change their credentials, keys or personal data
+func rejectDelegatedSession(c *gin.Context) bool {
+	if rejectAPIKeySession(c) {
+		return true
+	}
+	if middleware.GetImpersonator(c) != "" {
+		utils.ResponseError(c, http.StatusForbidden, "not allowed while impersonating", nil)
+		return true
+	}
+	return false
+}
+
+// CreateAPIKey godoc
+// @Summary     Create an API key
+// @Description Create a key for integrations. Scopes are permission names the owner has; a key only works on routes that require one of its scopes. The key is only shown in this response.
+// @Tags        API Keys
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       body  body      CreateAPIKeyRequest  true  "Key settings"
+// @Success     201   {object}  map[string]interface{}
+// @Failure     400   {object}  map[string]interface{}
+// @Failure     401   {object}  map[string]interface{}
+// @Failure     403   {object}  map[string]interface{}
+// @Failure     500   {object}  map[string]interface{}
+// @Router      /users/api-keys [post]
+func CreateAPIKey(c *gin.Context) {
+	if rejectDelegatedSession(c) {
+		return
+	}
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		utils.ResponseError(c, http.StatusBadRequest, "expires_at must be in the future", nil)
+		return
+	}
+	for _, entry := range req.AllowedIPs {
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			utils.ResponseError(c, http.StatusBadRequest, "invalid IP or CIDR: "+entry, nil)
+			return
+		}
+	}
+
+	granted, err := repository.GetUserPermissionNames(userId)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	grantedSet := make(map[string]bool, len(granted))
+	for _, p := range granted {
+		grantedSet[p] = true
+	}
+	claims := c.MustGet("claims").(*utils.JWTClaims)
+	for _, scope := range req.Scopes {
+		if !grantedSet[scope] {
+			utils.ResponseError(c, http.StatusForbidden, "you don't have the permission "+scope, nil)
+			return
+		}
+		// a key can't get around 2FA
+		if models.TwoFactorPermissions[scope] && !claims.MFA {
+			utils.ResponseError(c, http.StatusForbidden, "two-factor authentication required for scope "+scope, nil)
+			return
+		}
+	}
+
+	raw, prefix, hash, err := utils.GenerateAPIKey()
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	key := models.APIKey{
+		UserID:     userId,
+		Name:       req.Name,
+		Prefix:     prefix,
+		KeyHash:    hash,
+		Scopes:     strings.Join(req.Scopes, ","),
+		AllowedIPs: strings.Join(req.AllowedIPs, ","),
+		MFA:        claims.MFA,
+		ExpiresAt:  req.ExpiresAt,
+	}
+	if err := repository.CreateAPIKey(&key); err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusCreated, "API key created, store it now, it won't be shown again", gin.H{
+		"key":     raw,
+		"api_key": toAPIKeyResponse(&key),
+	})
+}
+
+// ListAPIKeys godoc
+// @Summary     List API keys
+// @Description List the current user's API keys, including revoked ones
+// @Tags        API Keys
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}
+// @Failure     401  {object}  map[string]interface{}
+// @Failure     500  {object}  map[string]interface{}
+// @Router      /users/api-keys [get]
+func ListAPIKeys(c *gin.Context) {
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	keys, err := repository.ListAPIKeys(userId)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	response := make([]APIKeyResponse, 0, len(keys))
+	for i := range keys {
+		response = append(response, toAPIKeyResponse(&keys[i]))
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", response)
+}
+
+// RevokeAPIKey godoc
+// @Summary     Revoke an API key
+// @Tags        API Keys
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "API key ID"
+// @Success     200  {object}  map[string]interface{}
+// @Failure     400  {object}  map[string]interface{}
+// @Failure     404  {object}  map[string]interface{}
+// @Failure     500  {object}  map[string]interface{}
+// @Router      /users/api-keys/{id} [delete]
+func RevokeAPIKey(c *gin.Context) {
+	if rejectDelegatedSession(c) {
+		return
+	}
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+	keyId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid API key ID", err)
+		return
+	}
+
+	if err := repository.RevokeAPIKey(userId, keyId); err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "API key not found", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "API key revoked", nil)
+}
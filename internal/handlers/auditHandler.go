@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/helper"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/middleware"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+)
+
+// recordAudit stores who did what to which entity, see auditEntry.
+// A failure is only logged, the change itself has already happened.
+// Where the repository can write the entry with the change, pass it auditEntry instead.
+func recordAudit(c *gin.Context, action string, targetType string, targetID string, before interface{}, after interface{}, metadata map[string]interface{}) {
+	entry, metadata := auditEntry(c, action, targetType, targetID, before, after, metadata)
+	if err := repository.RecordAudit(entry, metadata); err != nil {
+		log.Printf("Failed to audit %s: %v", action, err)
+	}
+}
+
+// auditEntry builds an audit entry for the request. before and after are snapshots of the
+// target, only the fields that differ end up in the entry; pass nil for a creation or deletion.
+// While impersonating, the admin behind the token is the actor.
+func auditEntry(c *gin.Context, action string, targetType string, targetID string, before interface{}, after interface{}, metadata map[string]interface{}) (models.AuditLog, map[string]interface{}) {
+	entry := models.AuditLog{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         c.ClientIP(),
+		RequestID:  middleware.GetRequestID(c),
+	}
+
+	actor := c.GetString("userId")
+	if impersonator := middleware.GetImpersonator(c); impersonator != "" {
+		if metadata == nil {
+			metadata = map[string]interface{}{}
+		}
+		metadata["impersonating"] = actor
+		actor = impersonator
+	}
+	if actorID, err := uuid.Parse(actor); err == nil {
+		entry.ActorID = &actorID
+	}
+
+	if before != nil || after != nil {
+		changes, err := utils.DiffFields(before, after)
+		if err != nil {
+			log.Printf("Failed to diff %s for audit: %v", action, err)
+		} else if len(changes) > 0 {
+			raw, _ := json.Marshal(changes)
+			changesJSON := string(raw)
+			entry.Changes = &changesJSON
+		}
+	}
+
+	return entry, metadata
+}
+
+// ListAuditLogs godoc
+// @Summary     Search the audit log (Admin)
+// @Description List audit entries, newest first
+// @Tags        Audit
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       actor_id     query     string  false  "Actor UUID"
+// @Param       action       query     string  false  "Action, e.g. product.update"
+// @Param       target_type  query     string  false  "Target type, e.g. product"
+// @Param       target_id    query     string  false  "Target ID"
+// @Param       request_id   query     string  false  "Request ID"
+// @Param       from         query     string  false  "From date (YYYY-MM-DD or RFC3339)"
+// @Param       to           query     string  false  "To date (YYYY-MM-DD or RFC3339)"
+// @Param       page         query     int     false  "Page number"  default(1)
+// @Param       limit        query     int     false  "Page size"    default(50)
+// @Success     200          {object}  map[string]interface{}
+// @Failure     400          {object}  map[string]interface{}
+// @Failure     500          {object}  map[string]interface{}
+// @Router      /admin/audit-logs [get]
+func ListAuditLogs(c *gin.Context) {
+	params, ok := auditLogFilter(c)
+	if !ok {
+		return
+	}
+
+	params.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	if params.Page < 1 {
+		params.Page = 1
+	}
+	params.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if params.Limit < 1 || params.Limit > 200 {
+		params.Limit = 50
+	}
+
+	entries, total, err := repository.ListAuditLogs(params)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", gin.H{
+		"entries": entries,
+		"meta": gin.H{
+			"page":  params.Page,
+			"limit": params.Limit,
+			"total": total,
+		},
+	})
+}
+
+// ExportAuditLogs godoc
+// @Summary     Export the audit log as CSV (Admin)
+// @Description Download every audit entry matching the filters, oldest first
+// @Tags        Audit
+// @Produce     text/csv
+// @Security    ApiKeyAuth
+// @Param       actor_id     query     string  false  "Actor UUID"
+// @Param       action       query     string  false  "Action, e.g. product.update"
+// @Param       target_type  query     string  false  "Target type, e.g. product"
+// @Param       target_id    query     string  false  "Target ID"
+// @Param       request_id   query     string  false  "Request ID"
+// @Param       from         query     string  false  "From date (YYYY-MM-DD or RFC3339)"
+// @Param       to           query     string  false  "To date (YYYY-MM-DD or RFC3339)"
+// @Success     200          {file}    file
+// @Failure     400          {object}  map[string]interface{}
+// @Router      /admin/audit-logs/export [get]
+func ExportAuditLogs(c *gin.Context) {
+	params, ok := auditLogFilter(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="audit-log-`+time.Now().UTC().Format("20060102-150405")+`.csv"`)
+	c.Status(http.StatusOK)
+
+	cw := csv.NewWriter(c.Writer)
+	cw.Write([]string{"id", "created_at", "actor_id", "action", "target_type", "target_id", "ip", "request_id", "changes", "metadata"})
+
+	err := repository.EachAuditLog(params, func(entry *models.AuditLog) error {
+		actorID := ""
+		if entry.ActorID != nil {
+			actorID = entry.ActorID.String()
+		}
+		return cw.Write([]string{
+			entry.ID.String(),
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			actorID,
+			entry.Action,
+			entry.TargetType,
+			csvCell(entry.TargetID),
+			entry.IP,
+			csvCell(entry.RequestID),
+			csvCell(derefString(entry.Changes)),
+			csvCell(derefString(entry.Metadata)),
+		})
+	})
+	cw.Flush()
+	// headers are already sent, all we can do is cut the file short
+	if err == nil {
+		err = cw.Error()
+	}
+	if err != nil {
+		log.Println("Audit log export failed:", err)
+		c.Abort()
+	}
+}
+
+// auditLogFilter reads the filters shared by the list and the export. On failure the response is already written.
+func auditLogFilter(c *gin.Context) (helper.AuditLogFilterParams, bool) {
+	params := helper.AuditLogFilterParams{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		RequestID:  c.Query("request_id"),
+	}
+
+	if raw := c.Query("actor_id"); raw != "" {
+		actorId, err := uuid.Parse(raw)
+		if err != nil {
+			utils.ResponseError(c, http.StatusBadRequest, "Invalid actor_id", nil)
+			return params, false
+		}
+		params.ActorID = &actorId
+	}
+
+	if raw := c.Query("from"); raw != "" {
+		from, _, err := parseDateParam(raw)
+		if err != nil {
+			utils.ResponseError(c, http.StatusBadRequest, "Invalid from date", nil)
+			return params, false
+		}
+		params.From = &from
+	}
+
+	if raw := c.Query("to"); raw != "" {
+		to, dateOnly, err := parseDateParam(raw)
+		if err != nil {
+			utils.ResponseError(c, http.StatusBadRequest, "Invalid to date", nil)
+			return params, false
+		}
+		// a plain date includes the whole day
+		if dateOnly {
+			to = to.Add(24 * time.Hour)
+		} else {
+			to = to.Add(time.Nanosecond)
+		}
+		params.To = &to
+	}
+
+	return params, true
+}
+
+// csvCell keeps spreadsheet apps from running a value that starts like a formula
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 
@@ -79,6 +80,7 @@ func CreateCart(c *gin.Context) {
 // @Produce     json
 // @Security    ApiKeyAuth
 // @Param       item  body      AddCartItemRequest  true  "Cart item data"
+// @Param       Idempotency-Key  header  string  false  "Key used to safely retry the request"
 // @Success     200   {object}  map[string]interface{}
 // @Failure     400   {object}  map[string]interface{}
 // @Failure     401   {object}  map[string]interface{}
@@ -252,12 +254,29 @@ func GetAllCartItems(c *gin.Context) {
 // @Security    ApiKeyAuth
 // @Param       userId  path      string  true  "User UUID"
 // @Success     200     {object}  map[string]interface{}
+// @Failure     400     {object}  map[string]interface{}
 // @Failure     401     {object}  map[string]interface{}
 // @Failure     403     {object}  map[string]interface{}
+// @Failure     404     {object}  map[string]interface{}
 // @Failure     500     {object}  map[string]interface{}
 // @Router      /cart/{userId} [get]
 func GetCart(c *gin.Context) {
+	userId, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
 
+	cart, err := repository.GetCartByUserId(userId)
+	if err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "Cart does not exist", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch cart", nil)
+		return
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", cart)
 }
 
 // DeleteCart godoc
@@ -269,12 +288,43 @@ func GetCart(c *gin.Context) {
 // @Security    ApiKeyAuth
 // @Param       userId  path      string  true  "User UUID"
 // @Success     200     {object}  map[string]interface{}
+// @Failure     400     {object}  map[string]interface{}
 // @Failure     401     {object}  map[string]interface{}
 // @Failure     403     {object}  map[string]interface{}
+// @Failure     404     {object}  map[string]interface{}
 // @Failure     500     {object}  map[string]interface{}
 // @Router      /cart/{userId} [delete]
 func DeleteCart(c *gin.Context) {
+	userId, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
 
+	cart, err := repository.DeleteCartByUserId(userId)
+	if err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "Cart does not exist", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Failed to delete cart", nil)
+		return
+	}
+
+	items := make([]map[string]interface{}, 0, len(cart.CartItems))
+	for _, item := range cart.CartItems {
+		items = append(items, map[string]interface{}{"product_id": item.ProductID, "quantity": item.Quantity})
+	}
+	recordAudit(c, models.AuditCartDelete, models.AuditTargetCart, cart.ID.String(), map[string]interface{}{
+		"user_id": cart.UserID,
+		"items":   items,
+	}, nil, nil)
+
+	cacheKey := fmt.Sprintf("cart:%s", cart.ID.String())
+	if err := config.RDB.Del(c.Request.Context(), cacheKey).Err(); err != nil {
+		log.Println("Failed to clear cache:", err)
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "Cart deleted", nil)
 }
 
 // RemoveCartItemFromCart godoc
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/mailer"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+)
+
+const (
+	defaultEmailVerificationTTL = 48 * time.Hour
+
+	// resend limits: one mail per cooldown, at most resendDailyLimit a day
+	resendCooldown   = time.Minute
+	resendDailyLimit = 5
+)
+
+// VerifyEmailRequest - request body for confirming an email address
+// @Description Email verification payload
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// sendVerificationEmail mails a fresh verification link for the user's current address
+func sendVerificationEmail(ctx context.Context, user *models.User) error {
+	env := config.LoadEnv()
+	ttl := config.DurationOr(env.EmailVerificationTTL, defaultEmailVerificationTTL)
+
+	raw, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	if err := repository.CreateUserToken(user.ID, models.TokenEmailVerification, user.Email, hash, ttl); err != nil {
+		return err
+	}
+
+	return mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Welcome %s!\n\n"+
+			"Please confirm your email address within %s by opening this link:\n%s",
+			user.Username, ttl, linkWithToken(env.EmailVerificationURL, raw)),
+	})
+}
+
+// VerifyEmail godoc
+// @Summary     Confirm email address
+// @Description Mark the account's email as verified using the token from the verification mail
+// @Tags        Auth
+// @Accept      json
+// @Produce     json
+// @Param       body  body      VerifyEmailRequest  true  "Verification token"
+// @Success     200   {object}  map[string]interface{}
+// @Failure     400   {object}  map[string]interface{}
+// @Failure     500   {object}  map[string]interface{}
+// @Router      /users/email/verify [post]
+func VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	user, err := repository.VerifyEmail(utils.HashToken(req.Token))
+	if err != nil {
+		if errors.Is(err, repository.ErrUserTokenInvalid) {
+			utils.ResponseError(c, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "email verified successfully", utils.ToUserResponse(user))
+}
+
+// ResendVerificationEmail godoc
+// @Summary     Resend verification email
+// @Description Send a new verification link to the current user. Limited to one per minute and five per day.
+// @Tags        Auth
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}
+// @Failure     401  {object}  map[string]interface{}
+// @Failure     409  {object}  map[string]interface{}
+// @Failure     429  {object}  map[string]interface{}
+// @Failure     500  {object}  map[string]interface{}
+// @Router      /users/email/verify/resend [post]
+func ResendVerificationEmail(c *gin.Context) {
+	ctx := c.Request.Context()
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	user, err := repository.GetUserByUUID(userId)
+	if err != nil {
+		utils.ResponseError(c, http.StatusNotFound, "User not found", nil)
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		utils.ResponseError(c, http.StatusConflict, repository.ErrEmailAlreadyVerified.Error(), nil)
+		return
+	}
+
+	retryAfter, err := takeResendSlot(ctx, userId)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+		utils.ResponseError(c, http.StatusTooManyRequests, "too many verification emails, try again later", nil)
+		return
+	}
+
+	if err := sendVerificationEmail(ctx, user); err != nil {
+		log.Printf("verification mail to %s failed: %v", user.ID, err)
+		utils.ResponseError(c, http.StatusInternalServerError, "could not send verification email", nil)
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "verification email sent", nil)
+}
+
+// takeResendSlot returns how long to wait when the user is over the resend limit, zero otherwise
+func takeResendSlot(ctx context.Context, userID uuid.UUID) (time.Duration, error) {
+	cooldownKey := "email_verification:cooldown:" + userID.String()
+	dailyKey := "email_verification:daily:" + userID.String()
+
+	ok, err := config.RDB.SetNX(ctx, cooldownKey, 1, resendCooldown).Result()
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		ttl, err := config.RDB.TTL(ctx, cooldownKey).Result()
+		if err != nil || ttl <= 0 {
+			ttl = resendCooldown
+		}
+		return ttl, nil
+	}
+
+	count, err := config.RDB.Incr(ctx, dailyKey).Result()
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		config.RDB.Expire(ctx, dailyKey, 24*time.Hour)
+	}
+	if count > resendDailyLimit {
+		ttl, err := config.RDB.TTL(ctx, dailyKey).Result()
+		if err != nil || ttl <= 0 {
+			ttl = 24 * time.Hour
+		}
+		return ttl, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/oidc"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+// oidcStateCookie ties the state to the browser that started the sign-in,
+// so nobody can finish their own sign-in in someone else's browser
+const oidcStateCookie = "oidc_state"
+
+// oidcState is kept in Redis between the redirect to the provider and the callback
+type oidcState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+func oidcStateKey(state string) string {
+	return "oidc_state:" + state
+}
+
+// OIDCLogin godoc
+// @Summary     Sign in with an identity provider
+// @Description Redirect to the provider's login page (authorization code flow with PKCE)
+// @Tags        Auth
+// @Param       provider  path  string  true  "Provider name, see OIDC_PROVIDERS"
+// @Success     302
+// @Failure     404  {object}  map[string]interface{}
+// @Failure     502  {object}  map[string]interface{}
+// @Router      /auth/oidc/{provider}/login [get]
+func OIDCLogin(c *gin.Context) {
+	provider, err := oidc.GetProvider(c.Param("provider"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusNotFound, err.Error(), nil)
+		return
+	}
+
+	state, err := oidc.RandomString(24)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	nonce, err := oidc.RandomString(24)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, challenge)
+	if err != nil {
+		log.Printf("oidc discovery for %s failed: %v", provider.Name, err)
+		utils.ResponseError(c, http.StatusBadGateway, "identity provider is unavailable", nil)
+		return
+	}
+
+	data, _ := json.Marshal(oidcState{Provider: provider.Name, Nonce: nonce, CodeVerifier: verifier})
+	if err := config.RDB.Set(c.Request.Context(), oidcStateKey(state), data, oidcStateTTL).Err(); err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+
+	setOIDCStateCookie(c, state, int(oidcStateTTL/time.Second))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// setOIDCStateCookie is scoped to this provider's login and callback paths.
+// It has to be Lax, the callback is a top-level redirect from the provider's site.
+func setOIDCStateCookie(c *gin.Context, value string, maxAge int) {
+	path := strings.TrimSuffix(strings.TrimSuffix(c.Request.URL.Path, "/login"), "/callback")
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, value, maxAge, path, "", secure, true)
+}
+
+// OIDCCallback godoc
+// @Summary     Identity provider callback
+// @Description Finish provider sign-in: the account is found by its link, linked by verified email, or created. Returns the same response as /users/login.
+// @Tags        Auth
+// @Produce     json
+// @Param       provider  path   string  true  "Provider name"
+// @Param       code      query  string  true  "Authorization code"
+// @Param       state     query  string  true  "State from the login redirect"
+// @Success     200  {object}  map[string]interface{}
+// @Failure     400  {object}  map[string]interface{}
+// @Failure     401  {object}  map[string]interface{}
+// @Failure     409  {object}  map[string]interface{}
+// @Router      /auth/oidc/{provider}/callback [get]
+func OIDCCallback(c *gin.Context) {
+	ctx := c.Request.Context()
+	if providerErr := c.Query("error"); providerErr != "" {
+		utils.ResponseError(c, http.StatusUnauthorized, "sign-in was not completed", gin.H{"error": providerErr, "description": c.Query("error_description")})
+		return
+	}
+
+	code, stateParam := c.Query("code"), c.Query("state")
+	if code == "" || stateParam == "" {
+		utils.ResponseError(c, http.StatusBadRequest, "code and state are required", nil)
+		return
+	}
+
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie), []byte(stateParam)) != 1 {
+		utils.ResponseError(c, http.StatusBadRequest, "invalid state", nil)
+		return
+	}
+	setOIDCStateCookie(c, "", -1)
+
+	// the state is single-use
+	raw, err := config.RDB.GetDel(ctx, oidcStateKey(stateParam)).Bytes()
+	if err == redis.Nil {
+		utils.ResponseError(c, http.StatusBadRequest, "sign-in expired, please start again", nil)
+		return
+	}
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	var state oidcState
+	if err := json.Unmarshal(raw, &state); err != nil || state.Provider != strings.ToLower(c.Param("provider")) {
+		utils.ResponseError(c, http.StatusBadRequest, "invalid state", nil)
+		return
+	}
+
+	provider, err := oidc.GetProvider(state.Provider)
+	if err != nil {
+		utils.ResponseError(c, http.StatusNotFound, err.Error(), nil)
+		return
+	}
+	claims, err := provider.Exchange(ctx, code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Printf("oidc exchange with %s failed: %v", provider.Name, err)
+		utils.ResponseError(c, http.StatusUnauthorized, "could not verify the identity provider's response", nil)
+		return
+	}
+
+	user, err := resolveOIDCUser(ctx, provider.Name, claims)
+	if err != nil {
+		if errors.Is(err, errOIDCEmailUnverified) {
+			utils.ResponseError(c, http.StatusConflict, err.Error(), nil)
+			return
+		}
+		if errors.Is(err, errSessionsNotRevoked) {
+			utils.ResponseError(c, http.StatusServiceUnavailable, err.Error(), nil)
+			return
+		}
+		log.Printf("oidc sign-in for %s/%s failed: %v", provider.Name, claims.Subject, err)
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+
+	finishLogin(c, user)
+}
+
+var errOIDCEmailUnverified = errors.New("an account with this email exists; verify the email at the provider to sign in with it")
+
+// resolveOIDCUser finds or creates the user for a provider account. An existing account is only
+// linked by email when the provider says it verified the address, otherwise anyone could claim it.
+func resolveOIDCUser(ctx context.Context, provider string, claims *oidc.IDTokenClaims) (*models.User, error) {
+	user, err := repository.GetUserByIdentity(provider, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !utils.IsNotFound(err) {
+		return nil, err
+	}
+
+	if claims.Email == "" {
+		return nil, errors.New("provider did not share an email address")
+	}
+
+	existing, err := repository.FindUserByEmailFold(claims.Email)
+	if err == nil {
+		if !claims.EmailVerified {
+			return nil, errOIDCEmailUnverified
+		}
+		if existing.EmailVerifiedAt == nil {
+			return claimUnverifiedAccount(ctx, existing, provider, claims)
+		}
+		if err := repository.LinkIdentity(existing.ID, provider, claims.Subject, claims.Email); err != nil {
+			return nil, err
+		}
+		return existing, nil
+	}
+	if !utils.IsNotFound(err) {
+		return nil, err
+	}
+
+	return createOIDCUser(provider, claims)
+}
+
+// claimUnverifiedAccount hands an account nobody ever verified to the person the provider vouches for.
+// Someone may have registered the address first to get into the account once it's linked,
+// so their password, second factor, keys and sessions stop working.
+func claimUnverifiedAccount(ctx context.Context, user *models.User, provider string, claims *oidc.IDTokenClaims) (*models.User, error) {
+	randomPassword, _, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	hashed, err := utils.HashPassword(randomPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	err = repository.ClaimAccountWithIdentity(user.ID, hashed, provider, claims.Subject, claims.Email)
+	if errors.Is(err, repository.ErrAccountAlreadyVerified) {
+		// verified in the meantime, a plain link is fine now
+		err = repository.LinkIdentity(user.ID, provider, claims.Subject, claims.Email)
+	} else if err == nil {
+		err = revokeAccessTokens(ctx, user.ID)
+		log.Printf("unverified account %s was claimed through %s, its credentials were reset", user.ID, provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return repository.GetUserByUUID(user.ID)
+}
+
+func createOIDCUser(provider string, claims *oidc.IDTokenClaims) (*models.User, error) {
+	username, err := uniqueUsername(claims.Email)
+	if err != nil {
+		return nil, err
+	}
+	// the account has no usable password until the user sets one through password reset
+	randomPassword, _, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	hashed, err := utils.HashPassword(randomPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	fullname := strings.TrimSpace(claims.Name)
+	if utf8.RuneCountInString(fullname) < 2 {
+		fullname = username
+	}
+	// cut by character, a byte cut could split a multi-byte one
+	if runes := []rune(fullname); len(runes) > 50 {
+		fullname = string(runes[:50])
+	}
+
+	user := models.User{
+		Fullname: fullname,
+		Username: username,
+		Email:    claims.Email,
+		Password: hashed,
+	}
+	if claims.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	if err := repository.CreateUserWithIdentity(&user, provider, claims.Subject); err != nil {
+		return nil, err
+	}
+	if err := repository.AssignRole(user.ID, models.RoleCustomer, nil); err != nil {
+		log.Printf("failed to assign customer role to %s: %v", user.ID, err)
+	}
+	return &user, nil
+}
+
+var usernameUnsafe = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// uniqueUsername derives a username from the email, adding a random suffix when it's taken
+func uniqueUsername(email string) (string, error) {
+	base := strings.ToLower(strings.SplitN(email, "@", 2)[0])
+	base = usernameUnsafe.ReplaceAllString(base, "")
+	if len(base) < 3 {
+		base = "user"
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	candidate := base
+	for i := 0; i < 5; i++ {
+		taken, err := repository.UsernameTaken(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s-%s", base, hex.EncodeToString(suffix))
+	}
+	return "", errors.New("could not find a free username")
+}
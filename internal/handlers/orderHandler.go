@@ -1,14 +1,23 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/helper"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/middleware"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
-	"github.com/shopspring/decimal"
 )
 
 // use goroutines and channels to handle multiple tasks concurrently
@@ -18,20 +27,33 @@ import (
 // Send a WhatsApp Notification.
 // Update Analytics Dashboard.
 
+// CheckoutRequest - optional body for checkout, omitted addresses use the user's defaults
+// @Description Addresses for the order
+type CheckoutRequest struct {
+	ShippingAddressID *uuid.UUID `json:"shipping_address_id"`
+	BillingAddressID  *uuid.UUID `json:"billing_address_id"` // falls back to the shipping address
+}
+
 // Checkout godoc
 // @Summary     Place an order (checkout)
-// @Description Creates an order from the authenticated user's cart
+// @Description Creates an order from the authenticated user's cart. The shipping and billing addresses are copied onto the order. A shipping address is only required when REQUIRE_SHIPPING_ADDRESS is on.
 // @Tags        Orders
 // @Accept      json
 // @Produce     json
 // @Security    ApiKeyAuth
-// @Success     200 {object} models.Order
+// @Param       Idempotency-Key header string false "Key used to safely retry the request"
+// @Param       body  body  CheckoutRequest  false  "Addresses, defaults are used when omitted"
+// @Success     201 {object} models.Order
 // @Failure     400 {object} map[string]interface{}
+// @Failure     401 {object} map[string]interface{}
+// @Failure     409 {object} map[string]interface{}
+// @Failure     500 {object} map[string]interface{}
 // @Router      /checkout [post]
 func Checkout(c *gin.Context) {
+	ctx := context.Background()
 	val, ok := c.Get("userId")
 	if !ok {
-		utils.ResponseError(c, http.StatusBadRequest, "Unauthorized", nil)
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
 		return
 	}
 
@@ -40,58 +62,423 @@ func Checkout(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err})
 		return
 	}
+	var req CheckoutRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+			return
+		}
+	}
+
 	cart, err := repository.GetCartByUserId(userId)
 	if err != nil {
 		utils.ResponseError(c, http.StatusBadRequest, "Cart Does not exist", nil)
 		return
 	}
-	var total decimal.Decimal
-	var finalOrderItems []models.OrderItem
 
-	for _, item := range cart.CartItems {
+	orderNumber, err := GenerateOrderNumber()
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Order Failed", nil)
+		return
+	}
+
+	// stock check, order creation, stock deduction and cart cleanup run in one transaction
+	order, err := repository.Checkout(cart.ID, userId, orderNumber, helper.CheckoutAddressParams{
+		ShippingAddressID: req.ShippingAddressID,
+		BillingAddressID:  req.BillingAddressID,
+		RequireShipping:   requireShippingAddress(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrCartEmpty):
+			utils.ResponseError(c, http.StatusBadRequest, "Cart is empty", nil)
+		case errors.Is(err, repository.ErrProductUnavailable):
+			utils.ResponseError(c, http.StatusBadRequest, "Product does not exist", nil)
+		case errors.Is(err, repository.ErrShippingAddressMissing), errors.Is(err, repository.ErrUnknownAddress):
+			utils.ResponseError(c, http.StatusBadRequest, err.Error(), nil)
+		case errors.Is(err, repository.ErrInsufficientStock):
+			utils.ResponseError(c, http.StatusConflict, "Product is out of stock", err.Error())
+		default:
+			utils.ResponseError(c, http.StatusInternalServerError, "Order Failed", nil)
+		}
+		return
+	}
+
+	cacheKey := fmt.Sprintf("cart:%s", cart.ID.String())
+	if err := config.RDB.Del(ctx, cacheKey).Err(); err != nil {
+		log.Println("Failed to clear cache:", err)
+	}
+
+	utils.ResponseSuccess(c, http.StatusCreated, "Order Placed", order)
+}
+
+var (
+	shippingRequired     bool
+	shippingRequiredOnce sync.Once
+)
+
+// requireShippingAddress reports whether checkout needs a shipping address (REQUIRE_SHIPPING_ADDRESS),
+// read once. Off by default, so clients that never sent addresses keep working.
+func requireShippingAddress() bool {
+	shippingRequiredOnce.Do(func() {
+		shippingRequired, _ = strconv.ParseBool(config.LoadEnv().RequireShippingAddress)
+	})
+	return shippingRequired
+}
+
+func CreateOrder(order *models.Order) {
+
+}
+
+// GenerateOrderNumber returns a unique, human friendly order number like ORD-20260114-000042-4
+func GenerateOrderNumber() (string, error) {
+	seq, err := repository.NextOrderNumberSequence()
+	if err != nil {
+		return "", err
+	}
+	return utils.FormatOrderNumber(utils.GetOrderNumberFormat(), time.Now(), seq), nil
+}
+
+type UpdateOrderStatusRequest struct {
+	Status models.OrderStatus `json:"status" binding:"required" example:"processing"`
+	Reason string             `json:"reason" binding:"max=500" example:"handed to warehouse"`
+}
+
+// UpdateOrderStatus godoc
+// @Summary     Advance order status (Admin)
+// @Description Move an order to a new status; only allowed transitions are accepted
+// @Tags        Orders
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id      path      string                    true  "Order UUID"
+// @Param       status  body      UpdateOrderStatusRequest  true  "New status"
+// @Success     200     {object}  models.Order
+// @Failure     400     {object}  map[string]interface{}
+// @Failure     404     {object}  map[string]interface{}
+// @Failure     409     {object}  map[string]interface{}
+// @Failure     500     {object}  map[string]interface{}
+// @Router      /admin/orders/{id}/status [patch]
+func UpdateOrderStatus(c *gin.Context) {
+	val, ok := c.Get("userId")
+	if !ok {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	actorId, err := uuid.Parse(val.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+
+	orderId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid order ID", err)
+		return
+	}
+
+	var req UpdateOrderStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+	if !req.Status.IsValid() {
+		utils.ResponseError(c, http.StatusBadRequest, "Unknown order status", nil)
+		return
+	}
+
+	order, from, err := repository.TransitionOrderStatus(orderId, req.Status, actorId, req.Reason)
+	if err != nil {
+		switch {
+		case utils.IsNotFound(err):
+			utils.ResponseError(c, http.StatusNotFound, "Order does not exist", nil)
+		case errors.Is(err, repository.ErrInvalidTransition):
+			utils.ResponseError(c, http.StatusConflict, "Illegal status transition", err.Error())
+		default:
+			utils.ResponseError(c, http.StatusInternalServerError, "Failed to update order status", nil)
+		}
+		return
+	}
+	recordAudit(c, models.AuditOrderStatusChange, models.AuditTargetOrder, order.ID.String(),
+		map[string]interface{}{"status": from}, map[string]interface{}{"status": order.Status},
+		map[string]interface{}{"reason": req.Reason})
+
+	utils.ResponseSuccess(c, http.StatusOK, "order status updated", order)
+}
+
+// GetOrderStatusHistory godoc
+// @Summary     Get order status history (Admin)
+// @Description List every status change of an order, oldest first
+// @Tags        Orders
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Order UUID"
+// @Success     200  {object}  map[string]interface{}
+// @Failure     400  {object}  map[string]interface{}
+// @Failure     500  {object}  map[string]interface{}
+// @Router      /admin/orders/{id}/history [get]
+func GetOrderStatusHistory(c *gin.Context) {
+	orderId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid order ID", err)
+		return
+	}
+
+	history, err := repository.GetOrderStatusHistory(orderId)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", history)
+}
+
+// GetMyOrders godoc
+// @Summary     List orders
+// @Description List the authenticated user's orders, newest first. Staff with order:manage see every order and may filter by user_id.
+// @Tags        Orders
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       page     query     int     false  "Page number"     default(1)
+// @Param       limit    query     int     false  "Page size"       default(10)
+// @Param       status   query     string  false  "Order status"
+// @Param       from     query     string  false  "Created on or after (YYYY-MM-DD or RFC3339)"
+// @Param       to       query     string  false  "Created on or before (YYYY-MM-DD or RFC3339)"
+// @Param       user_id  query     string  false  "User UUID (admin only)"
+// @Success     200      {object}  map[string]interface{}
+// @Failure     400      {object}  map[string]interface{}
+// @Failure     401      {object}  map[string]interface{}
+// @Failure     500      {object}  map[string]interface{}
+// @Router      /orders [get]
+func GetMyOrders(c *gin.Context) {
+	val, ok := c.Get("userId")
+	if !ok {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
 
-		product, err := repository.GetProductByUUID(item.ProductID)
+	userId, err := uuid.Parse(val.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if limit < 1 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	params := helper.OrderFilterParams{
+		UserID: &userId,
+		Page:   page,
+		Limit:  limit,
+	}
+
+	if middleware.HasPermission(c, models.PermOrderManage) {
+		params.UserID = nil
+		if raw := c.Query("user_id"); raw != "" {
+			filterUserId, err := uuid.Parse(raw)
+			if err != nil {
+				utils.ResponseError(c, http.StatusBadRequest, "Invalid user_id", nil)
+				return
+			}
+			params.UserID = &filterUserId
+		}
+	}
+
+	if status := c.Query("status"); status != "" {
+		if !models.OrderStatus(status).IsValid() {
+			utils.ResponseError(c, http.StatusBadRequest, "Unknown order status", nil)
+			return
+		}
+		params.Status = status
+	}
+
+	if raw := c.Query("from"); raw != "" {
+		from, _, err := parseDateParam(raw)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"Product does not exist": err})
+			utils.ResponseError(c, http.StatusBadRequest, "Invalid from date", nil)
 			return
 		}
-		if product.NumberOfStock < item.Quantity {
-			utils.ResponseError(c, http.StatusBadRequest, "Product is ut of stock", nil)
+		params.From = &from
+	}
+
+	if raw := c.Query("to"); raw != "" {
+		to, dateOnly, err := parseDateParam(raw)
+		if err != nil {
+			utils.ResponseError(c, http.StatusBadRequest, "Invalid to date", nil)
+			return
 		}
+		// a plain date includes the whole day
+		if dateOnly {
+			to = to.Add(24 * time.Hour)
+		} else {
+			to = to.Add(time.Nanosecond)
+		}
+		params.To = &to
+	}
 
-		// Deduct Stock
-		product.NumberOfStock = product.NumberOfStock - item.Quantity
-		repository.UpdateProduct(product)
+	orders, total, err := repository.ListOrders(params)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
 
-		finalOrderItems = append(finalOrderItems, models.OrderItem{
-			ProductID:    item.ProductID,
-			Quantity:     item.Quantity,
-			ProductPrice: product.BasePrice,
-		})
-		total = total.Add(product.BasePrice.Mul(decimal.NewFromInt(int64(item.Quantity))))
+	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", gin.H{
+		"orders": orders,
+		"meta": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
 
+// GetOrder godoc
+// @Summary     Get order by ID
+// @Description Retrieve an order with its items. Users can only see their own orders.
+// @Tags        Orders
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Order UUID"
+// @Success     200  {object}  models.Order
+// @Failure     400  {object}  map[string]interface{}
+// @Failure     401  {object}  map[string]interface{}
+// @Failure     404  {object}  map[string]interface{}
+// @Failure     500  {object}  map[string]interface{}
+// @Router      /orders/{id} [get]
+func GetOrder(c *gin.Context) {
+	val, ok := c.Get("userId")
+	if !ok {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
 	}
-	// 3. Create Order
-	order := models.Order{
-		UserID:      userId,
-		OrderNumber: GenerateOrderNumber(),
-		Subtotal:    total,
-		Status:      models.OrderPending,
-		OrderItems:  finalOrderItems,
-		TotalAmount: total,
+
+	userId, err := uuid.Parse(val.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
 	}
-	createdOrder, err := repository.CreateOrder(&order)
+
+	orderId, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		utils.ResponseError(c, http.StatusBadRequest, "Order Failed", nil)
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid order ID", err)
 		return
 	}
-	utils.ResponseSuccess(c, http.StatusBadRequest, "Order Placed", createdOrder)
+
+	order, err := repository.GetOrderByID(orderId)
+	if err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "Order does not exist", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+
+	// don't reveal that someone else's order exists
+	if order.UserID != userId && !middleware.HasPermission(c, models.PermOrderManage) {
+		utils.ResponseError(c, http.StatusNotFound, "Order does not exist", nil)
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", order)
 }
 
-func CreateOrder(order *models.Order) {
+// parseDateParam accepts either YYYY-MM-DD or RFC3339 and reports which one it got
+func parseDateParam(raw string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.DateOnly, raw); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	return t, false, err
+}
 
+type CancelOrderRequest struct {
+	Reason string `json:"reason" binding:"required,min=3,max=500" example:"ordered by mistake"`
 }
 
-func GenerateOrderNumber() string {
-	return "5"
+// CancelOrder godoc
+// @Summary     Cancel an order
+// @Description Cancel a pending or paid order. Stock is restored and paid orders get a refund request.
+// @Tags        Orders
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id      path      string              true  "Order UUID"
+// @Param       reason  body      CancelOrderRequest  true  "Cancellation reason"
+// @Success     200     {object}  map[string]interface{}
+// @Failure     400     {object}  map[string]interface{}
+// @Failure     401     {object}  map[string]interface{}
+// @Failure     404     {object}  map[string]interface{}
+// @Failure     409     {object}  map[string]interface{}
+// @Failure     500     {object}  map[string]interface{}
+// @Router      /orders/{id}/cancel [post]
+func CancelOrder(c *gin.Context) {
+	val, ok := c.Get("userId")
+	if !ok {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	userId, err := uuid.Parse(val.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+
+	orderId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid order ID", err)
+		return
+	}
+
+	var req CancelOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	existing, err := repository.GetOrderByID(orderId)
+	if err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "Order does not exist", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	if existing.UserID != userId && !middleware.HasPermission(c, models.PermOrderManage) {
+		utils.ResponseError(c, http.StatusNotFound, "Order does not exist", nil)
+		return
+	}
+
+	order, refund, err := repository.CancelOrder(orderId, userId, req.Reason)
+	if err != nil {
+		switch {
+		case utils.IsNotFound(err):
+			utils.ResponseError(c, http.StatusNotFound, "Order does not exist", nil)
+		case errors.Is(err, repository.ErrOrderNotCancelable):
+			utils.ResponseError(c, http.StatusConflict, "Order can no longer be cancelled", err.Error())
+		default:
+			utils.ResponseError(c, http.StatusInternalServerError, "Failed to cancel order", nil)
+		}
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "order cancelled", gin.H{
+		"order":  order,
+		"refund": refund,
+	})
 }
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/mailer"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+)
+
+const (
+	defaultPasswordResetTTL = time.Hour
+
+	// reset mails are sent by a few workers, requests beyond the queue are dropped
+	passwordResetWorkers   = 4
+	passwordResetQueueSize = 100
+)
+
+var (
+	passwordResetQueue       = make(chan string, passwordResetQueueSize)
+	passwordResetWorkersOnce sync.Once
+)
+
+// PasswordResetRequest - request body for asking a reset link
+// @Description Password reset request payload
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required,email" example:"john@example.com"`
+}
+
+// PasswordResetConfirmRequest - request body for setting a new password
+// @Description Password reset confirmation payload
+type PasswordResetConfirmRequest struct {
+	Token string `json:"token" binding:"required"`
+	// same rules as RegisterRequest.Password
+	Password string `json:"password" binding:"required,min=6" example:"newpassword123"`
+}
+
+// RequestPasswordReset godoc
+// @Summary     Request a password reset
+// @Description Mail a single-use reset link. The response is the same whether or not the email is registered.
+// @Tags        Auth
+// @Accept      json
+// @Produce     json
+// @Param       body  body      PasswordResetRequest  true  "Account email"
+// @Success     200   {object}  map[string]interface{}
+// @Failure     400   {object}  map[string]interface{}
+// @Router      /users/password/reset [post]
+func RequestPasswordReset(c *gin.Context) {
+	var req PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	// the work runs in the background so response time doesn't reveal if the account exists
+	queuePasswordReset(req.Email)
+
+	utils.ResponseSuccess(c, http.StatusOK, "if the email is registered, a reset link has been sent", nil)
+}
+
+// queuePasswordReset hands the email to the reset workers without waiting.
+// A flood of requests can't pile up goroutines, once the queue is full they're dropped.
+func queuePasswordReset(email string) {
+	passwordResetWorkersOnce.Do(func() {
+		for i := 0; i < passwordResetWorkers; i++ {
+			go func() {
+				for email := range passwordResetQueue {
+					sendPasswordReset(email)
+				}
+			}()
+		}
+	})
+
+	select {
+	case passwordResetQueue <- email:
+	default:
+		log.Println("password reset queue is full, request dropped")
+	}
+}
+
+func sendPasswordReset(email string) {
+	user, err := repository.GetUserByEmail(email)
+	if err != nil {
+		if !utils.IsNotFound(err) {
+			log.Printf("password reset lookup failed: %v", err)
+		}
+		return
+	}
+
+	err = mailPasswordResetLink(context.Background(), user,
+		"Someone asked to reset the password of your account.",
+		"If it wasn't you, ignore this email; your password stays the same.")
+	if err != nil {
+		log.Printf("password reset mail to %s failed: %v", user.ID, err)
+	}
+}
+
+// mailPasswordResetLink creates a reset token and mails the link between intro and outro
+func mailPasswordResetLink(ctx context.Context, user *models.User, intro string, outro string) error {
+	env := config.LoadEnv()
+	ttl := config.DurationOr(env.PasswordResetTTL, defaultPasswordResetTTL)
+	raw, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	if err := repository.CreateUserToken(user.ID, models.TokenPasswordReset, user.Email, hash, ttl); err != nil {
+		return err
+	}
+
+	return mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("%s\n\n"+
+			"Open this link within %s to choose a new one:\n%s\n\n%s",
+			intro, ttl, linkWithToken(env.PasswordResetURL, raw), outro),
+	})
+}
+
+// ConfirmPasswordReset godoc
+// @Summary     Reset password
+// @Description Set a new password with a reset token. Every existing session of the user is ended and their API keys are revoked.
+// @Tags        Auth
+// @Accept      json
+// @Produce     json
+// @Param       body  body      PasswordResetConfirmRequest  true  "Reset token and new password"
+// @Success     200   {object}  map[string]interface{}
+// @Failure     400   {object}  map[string]interface{}
+// @Failure     500   {object}  map[string]interface{}
+// @Router      /users/password/reset/confirm [post]
+func ConfirmPasswordReset(c *gin.Context) {
+	var req PasswordResetConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	hashed, err := utils.HashPassword(req.Password)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "failed to hash password", nil)
+		return
+	}
+
+	userId, err := repository.ResetPassword(utils.HashToken(req.Token), hashed)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserTokenInvalid) {
+			utils.ResponseError(c, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	if err := revokeAccessTokens(c.Request.Context(), userId); err != nil {
+		utils.ResponseError(c, http.StatusServiceUnavailable, "password has been reset, but "+err.Error(), nil)
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "password has been reset, please log in again", nil)
+}
+
+// linkWithToken appends the token as a query parameter to a frontend URL
+func linkWithToken(base string, token string) string {
+	u, err := url.Parse(base)
+	if err != nil || base == "" {
+		return token
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+var errSessionsNotRevoked = errors.New("existing sessions could not be ended, please try again")
+
+// revokeAccessTokens ends every access token of the user. The callers exist to cut off
+// stolen sessions, so a Redis failure must fail the request (503, like AuthMiddleware)
+// rather than report success while the old tokens still work.
+func revokeAccessTokens(ctx context.Context, userID uuid.UUID) error {
+	if err := utils.RevokeAllUserTokens(ctx, userID.String()); err != nil {
+		log.Printf("failed to revoke access tokens of %s: %v", userID, err)
+		return errSessionsNotRevoked
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/middleware"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/payments"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+)
+
+// StartPayment godoc
+// @Summary     Start payment for an order
+// @Description Create a payment intent with the configured provider. The order becomes paid once the capture is confirmed.
+// @Tags        Payments
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id               path      string  true   "Order UUID"
+// @Param       Idempotency-Key  header    string  false  "Key used to safely retry the request"
+// @Success     201              {object}  models.Payment
+// @Failure     400              {object}  map[string]interface{}
+// @Failure     401              {object}  map[string]interface{}
+// @Failure     404              {object}  map[string]interface{}
+// @Failure     409              {object}  map[string]interface{}
+// @Failure     502              {object}  map[string]interface{}
+// @Router      /orders/{id}/payments [post]
+func StartPayment(c *gin.Context) {
+	val, ok := c.Get("userId")
+	if !ok {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	userId, err := uuid.Parse(val.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+
+	orderId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid order ID", err)
+		return
+	}
+
+	order, err := repository.GetOrderByID(orderId)
+	if err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "Order does not exist", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	if order.UserID != userId {
+		utils.ResponseError(c, http.StatusNotFound, "Order does not exist", nil)
+		return
+	}
+
+	payment, err := payments.StartPayment(c.Request.Context(), order)
+	if err != nil {
+		if errors.Is(err, payments.ErrOrderNotPayable) {
+			utils.ResponseError(c, http.StatusConflict, "Order is not awaiting payment", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusBadGateway, "Payment provider error", err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusCreated, "payment started", payment)
+}
+
+// GetPayment godoc
+// @Summary     Get payment status
+// @Description Poll the payment state. The provider is queried and a confirmed payment is captured.
+// @Tags        Payments
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Payment UUID"
+// @Success     200  {object}  models.Payment
+// @Failure     400  {object}  map[string]interface{}
+// @Failure     401  {object}  map[string]interface{}
+// @Failure     404  {object}  map[string]interface{}
+// @Failure     502  {object}  map[string]interface{}
+// @Router      /payments/{id} [get]
+func GetPayment(c *gin.Context) {
+	val, ok := c.Get("userId")
+	if !ok {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	userId, err := uuid.Parse(val.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+
+	paymentId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid payment ID", err)
+		return
+	}
+
+	payment, err := repository.GetPaymentByID(paymentId)
+	if err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "Payment does not exist", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	if payment.Order.UserID != userId && !middleware.HasPermission(c, models.PermPaymentManage) {
+		utils.ResponseError(c, http.StatusNotFound, "Payment does not exist", nil)
+		return
+	}
+
+	payment, err = payments.SyncPayment(c.Request.Context(), payment)
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadGateway, "Payment provider error", err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", payment)
+}
+
+// PaymentWebhook godoc
+// @Summary     Receive payment provider webhook
+// @Description Verify the HMAC signature and timestamp, store the event once per provider event ID and apply it
+// @Tags        Payments
+// @Accept      json
+// @Produce     json
+// @Param       provider             path      string  true  "Provider name"
+// @Param       X-Webhook-Signature  header    string  true  "t=<unix>,v1=<hex hmac-sha256>"
+// @Success     200                  {object}  map[string]interface{}
+// @Failure     400                  {object}  map[string]interface{}
+// @Failure     401                  {object}  map[string]interface{}
+// @Failure     404                  {object}  map[string]interface{}
+// @Failure     500                  {object}  map[string]interface{}
+// @Router      /payments/webhooks/{provider} [post]
+func PaymentWebhook(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid request body", nil)
+		return
+	}
+
+	event, err := payments.HandleWebhook(c.Request.Context(), c.Param("provider"), c.GetHeader(payments.SignatureHeader), body)
+	if err != nil {
+		switch {
+		case errors.Is(err, payments.ErrUnknownGateway), errors.Is(err, payments.ErrWebhooksUnsupported):
+			utils.ResponseError(c, http.StatusNotFound, "Unknown payment provider", nil)
+		case errors.Is(err, payments.ErrInvalidSignature):
+			utils.ResponseError(c, http.StatusUnauthorized, "Invalid signature", nil)
+		case errors.Is(err, payments.ErrInvalidPayload):
+			utils.ResponseError(c, http.StatusBadRequest, "Invalid payload", err.Error())
+		default:
+			// non-2xx makes the provider retry later
+			utils.ResponseError(c, http.StatusInternalServerError, "Failed to process event", nil)
+		}
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "event received", gin.H{
+		"id":     event.ID,
+		"status": event.Status,
+	})
+}
+
+// ListWebhookEvents godoc
+// @Summary     List stored webhook events (Admin)
+// @Description Inspect inbound payment events, e.g. the ones that were unmatched or out of order
+// @Tags        Payments
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       status  query     string  false  "Event status"
+// @Param       page    query     int     false  "Page number"  default(1)
+// @Param       limit   query     int     false  "Page size"    default(10)
+// @Success     200     {object}  map[string]interface{}
+// @Failure     500     {object}  map[string]interface{}
+// @Router      /admin/payments/webhooks [get]
+func ListWebhookEvents(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if limit < 1 {
+		limit = 10
+	}
+	if limit > 200 {
+		limit = 200
+	}
+
+	events, total, err := repository.ListWebhookEvents(c.Query("status"), page, limit)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", gin.H{
+		"events": events,
+		"meta": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// ReprocessWebhookEvent godoc
+// @Summary     Re-process a stored webhook event (Admin)
+// @Description Apply a stored event again, ignoring the ordering check
+// @Tags        Payments
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Webhook event UUID"
+// @Success     200  {object}  models.PaymentWebhookEvent
+// @Failure     400  {object}  map[string]interface{}
+// @Failure     404  {object}  map[string]interface{}
+// @Failure     500  {object}  map[string]interface{}
+// @Router      /admin/payments/webhooks/{id}/reprocess [post]
+func ReprocessWebhookEvent(c *gin.Context) {
+	eventId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid event ID", err)
+		return
+	}
+
+	stored, err := repository.GetWebhookEventByID(eventId)
+	if err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "Event does not exist", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+
+	before := webhookEventAuditFields(stored)
+	event, err := payments.ReprocessWebhookEvent(c.Request.Context(), stored)
+	if event != nil {
+		recordAudit(c, models.AuditWebhookReprocess, models.AuditTargetWebhookEvent, eventId.String(), before, webhookEventAuditFields(event), map[string]interface{}{
+			"provider":   stored.Provider,
+			"event_type": stored.EventType,
+		})
+	}
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Failed to process event", err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "event processed", event)
+}
+
+func webhookEventAuditFields(e *models.PaymentWebhookEvent) map[string]interface{} {
+	return map[string]interface{}{
+		"status":     e.Status,
+		"error":      e.Error,
+		"attempts":   e.Attempts,
+		"payment_id": e.PaymentID,
+	}
+}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/privacy"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+)
+
+// CreateDataExportRequest - request body for requesting a copy of the own data
+// @Description Data export payload
+type CreateDataExportRequest struct {
+	Format models.DataExportFormat `json:"format" binding:"omitempty,oneof=json csv" example:"json"`
+}
+
+// EraseAccountRequest - request body for erasing the own account
+// @Description Account erasure payload
+type EraseAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// RequestDataExport godoc
+// @Summary     Request a data export
+// @Description Start building a zip archive of the profile, addresses, cart, orders, payments, refunds and returns, as JSON or one CSV file per section. Poll the export until it is ready.
+// @Tags        Privacy
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       body  body      CreateDataExportRequest  false  "Archive format, json by default"
+// @Success     202   {object}  models.DataExport
+// @Failure     400   {object}  map[string]interface{}
+// @Failure     403   {object}  map[string]interface{}
+// @Failure     409   {object}  map[string]interface{}
+// @Failure     500   {object}  map[string]interface{}
+// @Router      /users/me/exports [post]
+func RequestDataExport(c *gin.Context) {
+	if rejectDelegatedSession(c) {
+		return
+	}
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	var req CreateDataExportRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+			return
+		}
+	}
+	if req.Format == "" {
+		req.Format = models.ExportJSON
+	}
+
+	export, err := repository.CreateDataExport(userId, req.Format)
+	if err != nil {
+		if errors.Is(err, repository.ErrExportInProgress) {
+			utils.ResponseError(c, http.StatusConflict, err.Error(), nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	privacy.Enqueue(export.ID)
+
+	utils.ResponseSuccess(c, http.StatusAccepted, "data export requested", export)
+}
+
+// ListDataExports godoc
+// @Summary     List data exports
+// @Tags        Privacy
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {array}   models.DataExport
+// @Failure     401  {object}  map[string]interface{}
+// @Failure     500  {object}  map[string]interface{}
+// @Router      /users/me/exports [get]
+func ListDataExports(c *gin.Context) {
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	exports, err := repository.ListDataExports(userId)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", exports)
+}
+
+// GetDataExport godoc
+// @Summary     Get a data export
+// @Description Status of an export; download it once it is ready
+// @Tags        Privacy
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Export UUID"
+// @Success     200  {object}  models.DataExport
+// @Failure     400  {object}  map[string]interface{}
+// @Failure     404  {object}  map[string]interface{}
+// @Router      /users/me/exports/{id} [get]
+func GetDataExport(c *gin.Context) {
+	export, ok := findDataExport(c)
+	if !ok {
+		return
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", export)
+}
+
+// DownloadDataExport godoc
+// @Summary     Download a data export
+// @Description The zip archive of a ready export, until it expires
+// @Tags        Privacy
+// @Produce     application/zip
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Export UUID"
+// @Success     200  {file}    file
+// @Failure     403  {object}  map[string]interface{}
+// @Failure     404  {object}  map[string]interface{}
+// @Failure     409  {object}  map[string]interface{}
+// @Failure     410  {object}  map[string]interface{}
+// @Router      /users/me/exports/{id}/download [get]
+func DownloadDataExport(c *gin.Context) {
+	if rejectDelegatedSession(c) {
+		return
+	}
+	export, ok := findDataExport(c)
+	if !ok {
+		return
+	}
+	if export.Status != models.ExportReady {
+		utils.ResponseError(c, http.StatusConflict, "data export is not ready", export.Status)
+		return
+	}
+	if export.FilePath == "" || (export.ExpiresAt != nil && time.Now().After(*export.ExpiresAt)) {
+		utils.ResponseError(c, http.StatusGone, "data export has expired, request a new one", nil)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.FileAttachment(export.FilePath, "data-export-"+export.CreatedAt.Format("20060102")+".zip")
+}
+
+func findDataExport(c *gin.Context) (*models.DataExport, bool) {
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return nil, false
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid export ID", nil)
+		return nil, false
+	}
+
+	export, err := repository.GetDataExport(userId, id)
+	if err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "Data export not found", nil)
+			return nil, false
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return nil, false
+	}
+	return export, true
+}
+
+// EraseMe godoc
+// @Summary     Erase own account
+// @Description Anonymize the account's personal data and close it. Orders and payments are kept for bookkeeping without names or street addresses. Not possible while orders are still in progress.
+// @Tags        Privacy
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       body  body      EraseAccountRequest  true  "Current password"
+// @Success     200   {object}  map[string]interface{}
+// @Failure     400   {object}  map[string]interface{}
+// @Failure     401   {object}  map[string]interface{}
+// @Failure     403   {object}  map[string]interface{}
+// @Failure     409   {object}  map[string]interface{}
+// @Failure     500   {object}  map[string]interface{}
+// @Router      /users/me [delete]
+func EraseMe(c *gin.Context) {
+	if rejectDelegatedSession(c) {
+		return
+	}
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	var req EraseAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	user, err := repository.GetUserByUUID(userId)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	if !utils.CheckPassword(user.Password, req.Password) {
+		utils.ResponseError(c, http.StatusUnauthorized, "password is incorrect", nil)
+		return
+	}
+
+	if !eraseUser(c, userId) {
+		return
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "account erased", nil)
+}
+
+// EraseUser godoc
+// @Summary     Erase a user's account (Admin)
+// @Description Handle an erasure request received outside the app. Same rules as a self-service erasure.
+// @Tags        Users
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "User UUID"
+// @Success     200  {object}  map[string]interface{}
+// @Failure     400  {object}  map[string]interface{}
+// @Failure     403  {object}  map[string]interface{}
+// @Failure     404  {object}  map[string]interface{}
+// @Failure     409  {object}  map[string]interface{}
+// @Failure     500  {object}  map[string]interface{}
+// @Router      /admin/users/{id}/erase [post]
+func EraseUser(c *gin.Context) {
+	_, userId, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	if !eraseUser(c, userId) {
+		return
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "account erased", nil)
+}
+
+// eraseUser runs the erasure and records it. On failure the response is already written.
+func eraseUser(c *gin.Context, userID uuid.UUID) bool {
+	if err := privacy.Erase(c.Request.Context(), userID); err != nil {
+		switch {
+		case utils.IsNotFound(err):
+			utils.ResponseError(c, http.StatusNotFound, "User not found", nil)
+		case errors.Is(err, repository.ErrAlreadyErased), errors.Is(err, repository.ErrErasureBlocked):
+			utils.ResponseError(c, http.StatusConflict, err.Error(), nil)
+		default:
+			log.Printf("erasing user %s failed: %v", userID, err)
+			utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		}
+		return false
+	}
+
+	// the audit entry only refers to the id, it must not bring back what was erased
+	recordAudit(c, models.AuditUserErase, models.AuditTargetUser, userID.String(), nil, nil, nil)
+	return true
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/helper"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/middleware"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
@@ -82,6 +83,7 @@ func GetProductById(c *gin.Context) {
 // @Produce     json
 // @Security    ApiKeyAuth
 // @Param       product  body      helper.CreateProductRequest  true  "Product data"
+// @Param       Idempotency-Key  header  string  false  "Key used to safely retry the request"
 // @Success     200      {object}  map[string]interface{}
 // @Failure     400      {object}  map[string]interface{}
 // @Failure     401      {object}  map[string]interface{}
@@ -153,12 +155,13 @@ func CreateNewProduct(c *gin.Context) {
 		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", err)
 		return
 	}
+	recordAudit(c, models.AuditProductCreate, models.AuditTargetProduct, createdProduct.ID.String(), nil, productAuditFields(createdProduct), nil)
 	utils.ResponseSuccess(c, http.StatusOK, "product created successfully", createdProduct)
 }
 
 // UpdateProduct godoc
 // @Summary     Update a product
-// @Description Update product by ID (requires auth)
+// @Description Update product by ID. Sellers can only change their own products.
 // @Tags        Products
 // @Accept      json
 // @Produce     json
@@ -167,6 +170,8 @@ func CreateNewProduct(c *gin.Context) {
 // @Param       product  body      models.Product  true  "Product data"
 // @Success     200      {object}  map[string]interface{}
 // @Failure     400      {object}  map[string]interface{}
+// @Failure     403      {object}  map[string]interface{}
+// @Failure     404      {object}  map[string]interface{}
 // @Failure     500      {object}  map[string]interface{}
 // @Router      /products/{id} [put]
 func UpdateProduct(c *gin.Context) {
@@ -184,32 +189,40 @@ func UpdateProduct(c *gin.Context) {
 	}
 
 	existingProduct, err := repository.GetProductByUUID(productID)
-
 	if err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "Product does not exist", nil)
+			return
+		}
 		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", err)
 		return
 	}
 
-	if existingProduct.CreatedBy != uuid.MustParse("f064c2fc-3523-4e1b-b166-e2cc57064fd8") {
-		utils.ResponseError(c, http.StatusBadRequest, "You are not authorized", err)
+	if !canEditProduct(c, existingProduct) {
+		utils.ResponseError(c, http.StatusForbidden, "You are not authorized", nil)
 		return
 	}
 
-	if err := repository.UpdateProduct(&product); err != nil {
+	product.ID = productID
+	_, after, err := repository.UpdateProduct(&product, func(before, after *models.Product) (models.AuditLog, map[string]interface{}) {
+		return auditEntry(c, models.AuditProductUpdate, models.AuditTargetProduct, productID.String(), productAuditFields(before), productAuditFields(after), nil)
+	})
+	if err != nil {
 		utils.ResponseError(c, http.StatusInternalServerError, "Update failed", err)
 		return
 	}
+
 	// 2. Invalidate Cache (Delete the specific key)
-	cacheKey := fmt.Sprintf("product:details:%s", product.ID.String())
+	cacheKey := fmt.Sprintf("product:details:%s", productID.String())
 	if err := config.RDB.Del(ctx, cacheKey).Err(); err != nil {
 		fmt.Println("Failed to clear cache:", err)
 	}
-	utils.ResponseSuccess(c, http.StatusOK, "product updated successfully", product)
+	utils.ResponseSuccess(c, http.StatusOK, "product updated successfully", after)
 }
 
 // DeleteProduct godoc
 // @Summary     Delete a product
-// @Description Delete product by ID (requires auth)
+// @Description Delete product by ID. Sellers can only delete their own products.
 // @Tags        Products
 // @Accept      json
 // @Produce     json
@@ -217,10 +230,69 @@ func UpdateProduct(c *gin.Context) {
 // @Param       id   path      string  true  "Product UUID"
 // @Success     200  {object}  map[string]interface{}
 // @Failure     400  {object}  map[string]interface{}
+// @Failure     403  {object}  map[string]interface{}
+// @Failure     404  {object}  map[string]interface{}
 // @Failure     500  {object}  map[string]interface{}
 // @Router      /products/{id} [delete]
 func DeleteProduct(c *gin.Context) {
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid Id", err)
+		return
+	}
+
+	existingProduct, err := repository.GetProductByUUID(productID)
+	if err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "Product does not exist", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	if !canEditProduct(c, existingProduct) {
+		utils.ResponseError(c, http.StatusForbidden, "You are not authorized", nil)
+		return
+	}
 
+	_, err = repository.DeleteProduct(productID, func(before, _ *models.Product) (models.AuditLog, map[string]interface{}) {
+		return auditEntry(c, models.AuditProductDelete, models.AuditTargetProduct, productID.String(), productAuditFields(before), nil, nil)
+	})
+	if err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "Product does not exist", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+
+	cacheKey := fmt.Sprintf("product:details:%s", productID.String())
+	if err := config.RDB.Del(c.Request.Context(), cacheKey).Err(); err != nil {
+		log.Println("Failed to clear cache:", err)
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "product deleted successfully", nil)
+}
+
+// canEditProduct lets sellers change their own products, and staff with product:manage anyone's
+func canEditProduct(c *gin.Context, product *models.Product) bool {
+	return product.CreatedBy.String() == c.GetString("userId") || middleware.HasPermission(c, models.PermProductManage)
+}
+
+// productAuditFields is what the audit log compares when a product changes
+func productAuditFields(p *models.Product) map[string]interface{} {
+	return map[string]interface{}{
+		"name":              p.Name,
+		"short_description": p.ShortDescription,
+		"base_price":        p.BasePrice,
+		"discount_percent":  p.DiscountPercent,
+		"currency":          p.Currency,
+		"is_returnable":     p.IsReturnable,
+		"is_cod_available":  p.IsCodAvailable,
+		"number_of_stock":   p.NumberOfStock,
+		"status":            p.Status,
+		"created_by":        p.CreatedBy,
+	}
 }
 
 // some helper function to get product with caching
@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/helper"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/mailer"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/storage"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+)
+
+const maxAvatarSize = 2 << 20
+
+// avatarTypes maps the sniffed content type of an accepted avatar to its file extension
+var avatarTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// UpdateProfileRequest - request body for changing the own profile, omitted fields stay the same
+// @Description Profile update payload
+type UpdateProfileRequest struct {
+	Fullname *string `json:"fullname" binding:"omitempty,min=2,max=50" example:"John Doe"`
+	Username *string `json:"username" binding:"omitempty,min=3,max=50" example:"johndoe"`
+	Email    *string `json:"email" binding:"omitempty,email,max=100" example:"john@example.com"`
+	// CurrentPassword is required to change the email, it's what password resets are sent to
+	CurrentPassword string `json:"current_password"`
+}
+
+// ChangePasswordRequest - request body for changing the password while logged in
+// @Description Password change payload
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6" example:"newpassword123"`
+}
+
+// GetMe godoc
+// @Summary     Get own profile
+// @Description Profile of the logged in user
+// @Tags        Profile
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}
+// @Failure     401  {object}  map[string]interface{}
+// @Failure     404  {object}  map[string]interface{}
+// @Router      /users/me [get]
+func GetMe(c *gin.Context) {
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	user, err := repository.GetUserByUUID(userId)
+	if err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "User not found", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", utils.ToUserResponse(user))
+}
+
+// UpdateMe godoc
+// @Summary     Update own profile
+// @Description Change fullname, username or email. Changing the email needs the current password. A new email address has to be verified again; a link is sent to it and the old address is told about the change.
+// @Tags        Profile
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       body  body      UpdateProfileRequest  true  "Changed fields"
+// @Success     200   {object}  map[string]interface{}
+// @Failure     400   {object}  map[string]interface{}
+// @Failure     401   {object}  map[string]interface{}
+// @Failure     403   {object}  map[string]interface{}
+// @Failure     409   {object}  map[string]interface{}
+// @Failure     500   {object}  map[string]interface{}
+// @Router      /users/me [patch]
+func UpdateMe(c *gin.Context) {
+	if rejectDelegatedSession(c) {
+		return
+	}
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	if req.Email != nil {
+		current, err := repository.GetUserByUUID(userId)
+		if err != nil {
+			utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+			return
+		}
+		if !strings.EqualFold(*req.Email, current.Email) && !utils.CheckPassword(current.Password, req.CurrentPassword) {
+			utils.ResponseError(c, http.StatusUnauthorized, "current password is incorrect", nil)
+			return
+		}
+	}
+
+	user, previousEmail, err := repository.UpdateUserProfile(userId, helper.ProfileUpdateParams{
+		Fullname: req.Fullname,
+		Username: req.Username,
+		Email:    req.Email,
+	})
+	if err != nil {
+		if utils.IsNotFound(err) {
+			utils.ResponseError(c, http.StatusNotFound, "User not found", nil)
+			return
+		}
+		if msg, ok := utils.ParsePostgresError(err); ok {
+			utils.ResponseError(c, http.StatusConflict, msg, nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+
+	if previousEmail != "" {
+		go func(user models.User, previousEmail string) {
+			ctx := context.Background()
+			if err := sendVerificationEmail(ctx, &user); err != nil {
+				log.Printf("verification mail to %s failed: %v", user.ID, err)
+			}
+			if err := mailer.Send(ctx, mailer.Message{
+				To:      previousEmail,
+				Subject: "Your email address was changed",
+				Body: fmt.Sprintf("Hi %s,\n\n"+
+					"The email address of your account was changed to %s.\n"+
+					"If you didn't do this, reset your password and contact support.",
+					user.Username, user.Email),
+			}); err != nil {
+				log.Printf("email change notice to %s failed: %v", user.ID, err)
+			}
+		}(*user, previousEmail)
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "profile updated successfully", utils.ToUserResponse(user))
+}
+
+// ChangePassword godoc
+// @Summary     Change password
+// @Description Set a new password after confirming the current one. Every session is ended, including this one, so the user has to log in again. API keys are revoked too.
+// @Tags        Profile
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       body  body      ChangePasswordRequest  true  "Current and new password"
+// @Success     200   {object}  map[string]interface{}
+// @Failure     400   {object}  map[string]interface{}
+// @Failure     401   {object}  map[string]interface{}
+// @Failure     403   {object}  map[string]interface{}
+// @Failure     500   {object}  map[string]interface{}
+// @Router      /users/me/password [post]
+func ChangePassword(c *gin.Context) {
+	if rejectDelegatedSession(c) {
+		return
+	}
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	user, err := repository.GetUserByUUID(userId)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	if !utils.CheckPassword(user.Password, req.CurrentPassword) {
+		utils.ResponseError(c, http.StatusUnauthorized, "current password is incorrect", nil)
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		utils.ResponseError(c, http.StatusBadRequest, "new password must be different from the current one", nil)
+		return
+	}
+
+	if err := setPassword(c.Request.Context(), userId, req.NewPassword); err != nil {
+		if errors.Is(err, errSessionsNotRevoked) {
+			utils.ResponseError(c, http.StatusServiceUnavailable, "password changed, but "+err.Error(), nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "password changed, please log in again", nil)
+}
+
+// UploadAvatar godoc
+// @Summary     Upload avatar
+// @Description Replace the profile picture. JPEG, PNG, GIF or WebP up to 2 MB.
+// @Tags        Profile
+// @Accept      multipart/form-data
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       avatar  formData  file  true  "Image file"
+// @Success     200     {object}  map[string]interface{}
+// @Failure     400     {object}  map[string]interface{}
+// @Failure     403     {object}  map[string]interface{}
+// @Failure     413     {object}  map[string]interface{}
+// @Failure     500     {object}  map[string]interface{}
+// @Router      /users/me/avatar [put]
+func UploadAvatar(c *gin.Context) {
+	if rejectDelegatedSession(c) {
+		return
+	}
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	// leave room for the multipart envelope around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAvatarSize+64<<10)
+	header, err := c.FormFile("avatar")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.ResponseError(c, http.StatusRequestEntityTooLarge, "avatar must be at most 2 MB", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusBadRequest, "avatar file is required", nil)
+		return
+	}
+	if header.Size > maxAvatarSize {
+		utils.ResponseError(c, http.StatusRequestEntityTooLarge, "avatar must be at most 2 MB", nil)
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "could not read avatar", nil)
+		return
+	}
+	defer file.Close()
+
+	// trust the bytes, not the file name or the client's content type
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		utils.ResponseError(c, http.StatusBadRequest, "could not read avatar", nil)
+		return
+	}
+	contentType := http.DetectContentType(sniff[:n])
+	ext, ok := avatarTypes[contentType]
+	if !ok {
+		utils.ResponseError(c, http.StatusBadRequest, "avatar must be a JPEG, PNG, GIF or WebP image", nil)
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+
+	backend, err := storage.Default()
+	if err != nil {
+		log.Println("Storage backend unavailable:", err)
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+
+	ctx := c.Request.Context()
+	key := fmt.Sprintf("avatars/%s/%s%s", userId, uuid.New(), ext)
+	url, err := backend.Put(ctx, key, file, contentType)
+	if err != nil {
+		log.Printf("avatar upload for %s failed: %v", userId, err)
+		utils.ResponseError(c, http.StatusInternalServerError, "could not store avatar", nil)
+		return
+	}
+
+	previous, err := repository.SetAvatarURL(userId, url)
+	if err != nil {
+		if err := backend.Delete(ctx, url); err != nil {
+			log.Printf("failed to clean up avatar %s: %v", url, err)
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	// the old file is only garbage now, don't fail the request over it
+	if previous != "" {
+		if err := backend.Delete(ctx, previous); err != nil {
+			log.Printf("failed to delete old avatar %s: %v", previous, err)
+		}
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "avatar updated successfully", gin.H{"avatar_url": url})
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/helper"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/payments"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+	"github.com/shopspring/decimal"
+)
+
+type RefundItemRequest struct {
+	OrderItemID uuid.UUID `json:"order_item_id" binding:"required"`
+	Quantity    int       `json:"quantity" binding:"required,min=1"`
+}
+
+// CreateRefundRequest - either items or amount must be given
+// @Description Refund payload
+type CreateRefundRequest struct {
+	Amount  decimal.Decimal     `json:"amount" swaggertype:"string" example:"199.50"`
+	Items   []RefundItemRequest `json:"items" binding:"omitempty,dive"`
+	Reason  string              `json:"reason" binding:"required,min=3,max=500" example:"damaged in transit"`
+	Restock bool                `json:"restock"`
+}
+
+// CreateRefund godoc
+// @Summary     Refund an order (Admin)
+// @Description Issue a full or partial refund by amount or by order items. Never refunds more than was captured.
+// @Tags        Refunds
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id      path      string               true  "Order UUID"
+// @Param       refund  body      CreateRefundRequest  true  "Refund data"
+// @Success     201     {object}  models.Refund
+// @Failure     400     {object}  map[string]interface{}
+// @Failure     404     {object}  map[string]interface{}
+// @Failure     409     {object}  map[string]interface{}
+// @Failure     502     {object}  map[string]interface{}
+// @Router      /admin/orders/{id}/refunds [post]
+func CreateRefund(c *gin.Context) {
+	val, ok := c.Get("userId")
+	if !ok {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	actorId, err := uuid.Parse(val.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+
+	orderId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid order ID", err)
+		return
+	}
+
+	var req CreateRefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+	if len(req.Items) == 0 && !req.Amount.IsPositive() {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", "either amount or items is required")
+		return
+	}
+	if len(req.Items) > 0 && !req.Amount.IsZero() {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", "amount is derived from items, don't send both")
+		return
+	}
+
+	params := helper.RefundParams{
+		OrderID: orderId,
+		ActorID: actorId,
+		Amount:  req.Amount,
+		Reason:  req.Reason,
+		Restock: req.Restock,
+	}
+	for _, item := range req.Items {
+		params.Items = append(params.Items, helper.RefundItemParams{
+			OrderItemID: item.OrderItemID,
+			Quantity:    item.Quantity,
+		})
+	}
+
+	refund, err := payments.IssueRefund(c.Request.Context(), params)
+	if refund != nil {
+		auditRefund(c, models.AuditRefundCreate, nil, refund)
+	}
+	if err != nil {
+		respondRefundError(c, refund, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusCreated, "refund issued", refund)
+}
+
+// ProcessRefund godoc
+// @Summary     Process a requested refund (Admin)
+// @Description Send a pending refund request, e.g. one created by an order cancellation, to the payment provider. A refund that has been waiting on the provider for over 10 minutes is sent again.
+// @Tags        Refunds
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Refund UUID"
+// @Success     200  {object}  models.Refund
+// @Failure     400  {object}  map[string]interface{}
+// @Failure     404  {object}  map[string]interface{}
+// @Failure     409  {object}  map[string]interface{}
+// @Failure     502  {object}  map[string]interface{}
+// @Router      /admin/refunds/{id}/process [post]
+func ProcessRefund(c *gin.Context) {
+	val, ok := c.Get("userId")
+	if !ok {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	actorId, err := uuid.Parse(val.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+
+	refundId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid refund ID", err)
+		return
+	}
+
+	before, err := repository.GetRefundByID(refundId)
+	if err != nil {
+		respondRefundError(c, nil, err)
+		return
+	}
+
+	refund, err := payments.ProcessRefund(c.Request.Context(), refundId, actorId)
+	if refund != nil {
+		auditRefund(c, models.AuditRefundProcess, before, refund)
+	}
+	if err != nil {
+		respondRefundError(c, refund, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "refund processed", refund)
+}
+
+// GetOrderRefunds godoc
+// @Summary     List refunds of an order (Admin)
+// @Tags        Refunds
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Order UUID"
+// @Success     200  {object}  map[string]interface{}
+// @Failure     400  {object}  map[string]interface{}
+// @Failure     500  {object}  map[string]interface{}
+// @Router      /admin/orders/{id}/refunds [get]
+func GetOrderRefunds(c *gin.Context) {
+	orderId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid order ID", err)
+		return
+	}
+
+	refunds, err := repository.GetRefundsByOrder(orderId)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", refunds)
+}
+
+// auditRefund records a refund issued or processed by an admin.
+// It's also called when the provider rejected the refund, the entry then shows it failed.
+func auditRefund(c *gin.Context, action string, before *models.Refund, refund *models.Refund) {
+	var from interface{}
+	if before != nil {
+		from = refundAuditFields(before)
+	}
+	recordAudit(c, action, models.AuditTargetRefund, refund.ID.String(), from, refundAuditFields(refund), map[string]interface{}{
+		"order_id": refund.OrderID,
+	})
+}
+
+func refundAuditFields(r *models.Refund) map[string]interface{} {
+	return map[string]interface{}{
+		"payment_id":     r.PaymentID,
+		"amount":         r.Amount,
+		"status":         r.Status,
+		"reason":         r.Reason,
+		"restock":        r.Restock,
+		"provider_ref":   r.ProviderRef,
+		"failure_reason": r.FailureReason,
+	}
+}
+
+func respondRefundError(c *gin.Context, refund interface{}, err error) {
+	switch {
+	case utils.IsNotFound(err):
+		utils.ResponseError(c, http.StatusNotFound, "Not found", nil)
+	case errors.Is(err, repository.ErrInvalidRefundItem):
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid refund", err.Error())
+	case errors.Is(err, repository.ErrNothingToRefund),
+		errors.Is(err, repository.ErrRefundExceedsCaptured),
+		errors.Is(err, repository.ErrRefundNotPending):
+		utils.ResponseError(c, http.StatusConflict, "Refund not allowed", err.Error())
+	case errors.Is(err, payments.ErrRefundPending):
+		utils.ResponseError(c, http.StatusBadGateway, "Refund pending", gin.H{"refund": refund, "reason": err.Error()})
+	case errors.Is(err, payments.ErrRefundFailed):
+		utils.ResponseError(c, http.StatusBadGateway, "Refund failed", gin.H{"refund": refund, "reason": err.Error()})
+	default:
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+	}
+}
@@ -0,0 +1,452 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/helper"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/middleware"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/payments"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+)
+
+const defaultReturnWindowDays = 30
+
+type ReturnItemRequest struct {
+	OrderItemID uuid.UUID `json:"order_item_id" binding:"required"`
+	Quantity    int       `json:"quantity" binding:"required,min=1"`
+	Reason      string    `json:"reason" binding:"max=500"`
+}
+
+type CreateReturnRequest struct {
+	Reason string              `json:"reason" binding:"required,min=3,max=500" example:"wrong size"`
+	Items  []ReturnItemRequest `json:"items" binding:"required,min=1,dive"`
+}
+
+type ReturnStepRequest struct {
+	Note string `json:"note" binding:"max=500"`
+}
+
+type InspectReturnRequest struct {
+	Passed *bool  `json:"passed" binding:"required"`
+	Note   string `json:"note" binding:"max=500"`
+}
+
+// RequestReturn godoc
+// @Summary     Request a return
+// @Description Open a return (RMA) for returnable items of a delivered order, within the return window
+// @Tags        Returns
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id      path      string               true  "Order UUID"
+// @Param       return  body      CreateReturnRequest  true  "Items to return"
+// @Success     201     {object}  models.ReturnRequest
+// @Failure     400     {object}  map[string]interface{}
+// @Failure     404     {object}  map[string]interface{}
+// @Failure     409     {object}  map[string]interface{}
+// @Router      /orders/{id}/returns [post]
+func RequestReturn(c *gin.Context) {
+	val, ok := c.Get("userId")
+	if !ok {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	userId, err := uuid.Parse(val.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+
+	orderId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid order ID", err)
+		return
+	}
+
+	var req CreateReturnRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	items := make([]helper.ReturnItemParams, 0, len(req.Items))
+	for _, item := range req.Items {
+		items = append(items, helper.ReturnItemParams{
+			OrderItemID: item.OrderItemID,
+			Quantity:    item.Quantity,
+			Reason:      item.Reason,
+		})
+	}
+
+	rma, err := repository.CreateReturnRequest(orderId, userId, req.Reason, items, returnWindow())
+	if err != nil {
+		respondReturnError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusCreated, "return requested", rma)
+}
+
+// GetOrderReturns godoc
+// @Summary     List returns of an order
+// @Tags        Returns
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Order UUID"
+// @Success     200  {object}  map[string]interface{}
+// @Failure     400  {object}  map[string]interface{}
+// @Failure     404  {object}  map[string]interface{}
+// @Router      /orders/{id}/returns [get]
+func GetOrderReturns(c *gin.Context) {
+	val, ok := c.Get("userId")
+	if !ok {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	userId, err := uuid.Parse(val.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+
+	orderId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid order ID", err)
+		return
+	}
+
+	order, err := repository.GetOrderByID(orderId)
+	if err != nil || (order.UserID != userId && !middleware.HasPermission(c, models.PermReturnManage)) {
+		utils.ResponseError(c, http.StatusNotFound, "Order does not exist", nil)
+		return
+	}
+
+	returns, err := repository.GetReturnsByOrder(orderId)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", returns)
+}
+
+// GetReturn godoc
+// @Summary     Get a return
+// @Description Retrieve a return with its items and every step taken so far
+// @Tags        Returns
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "Return UUID"
+// @Success     200  {object}  models.ReturnRequest
+// @Failure     400  {object}  map[string]interface{}
+// @Failure     404  {object}  map[string]interface{}
+// @Router      /returns/{id} [get]
+func GetReturn(c *gin.Context) {
+	val, ok := c.Get("userId")
+	if !ok {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	userId, err := uuid.Parse(val.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+
+	returnId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid return ID", err)
+		return
+	}
+
+	rma, err := repository.GetReturnByID(returnId)
+	if err != nil || (rma.UserID != userId && !middleware.HasPermission(c, models.PermReturnManage)) {
+		utils.ResponseError(c, http.StatusNotFound, "Return does not exist", nil)
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", rma)
+}
+
+// ListReturns godoc
+// @Summary     List returns (Admin)
+// @Tags        Returns
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       status  query     string  false  "Return status"
+// @Param       page    query     int     false  "Page number"  default(1)
+// @Param       limit   query     int     false  "Page size"    default(10)
+// @Success     200     {object}  map[string]interface{}
+// @Failure     500     {object}  map[string]interface{}
+// @Router      /admin/returns [get]
+func ListReturns(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if limit < 1 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	returns, total, err := repository.ListReturns(c.Query("status"), page, limit)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", gin.H{
+		"returns": returns,
+		"meta": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// ApproveReturn godoc
+// @Summary     Approve a return (Admin)
+// @Tags        Returns
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id    path      string             true   "Return UUID"
+// @Param       note  body      ReturnStepRequest  false  "Note"
+// @Success     200   {object}  models.ReturnRequest
+// @Failure     409   {object}  map[string]interface{}
+// @Router      /admin/returns/{id}/approve [post]
+func ApproveReturn(c *gin.Context) {
+	advanceReturn(c, models.ReturnApproved)
+}
+
+// RejectReturn godoc
+// @Summary     Reject a return (Admin)
+// @Tags        Returns
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id    path      string             true   "Return UUID"
+// @Param       note  body      ReturnStepRequest  false  "Note"
+// @Success     200   {object}  models.ReturnRequest
+// @Failure     409   {object}  map[string]interface{}
+// @Router      /admin/returns/{id}/reject [post]
+func RejectReturn(c *gin.Context) {
+	advanceReturn(c, models.ReturnRejected)
+}
+
+// ReceiveReturn godoc
+// @Summary     Mark returned items as received (Admin)
+// @Tags        Returns
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id    path      string             true   "Return UUID"
+// @Param       note  body      ReturnStepRequest  false  "Note"
+// @Success     200   {object}  models.ReturnRequest
+// @Failure     409   {object}  map[string]interface{}
+// @Router      /admin/returns/{id}/receive [post]
+func ReceiveReturn(c *gin.Context) {
+	advanceReturn(c, models.ReturnReceived)
+}
+
+// InspectReturn godoc
+// @Summary     Record inspection result (Admin)
+// @Description A passed inspection refunds the returned items and puts them back in stock
+// @Tags        Returns
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id      path      string                true  "Return UUID"
+// @Param       result  body      InspectReturnRequest  true  "Inspection result"
+// @Success     200     {object}  models.ReturnRequest
+// @Failure     400     {object}  map[string]interface{}
+// @Failure     409     {object}  map[string]interface{}
+// @Failure     502     {object}  map[string]interface{}
+// @Router      /admin/returns/{id}/inspect [post]
+func InspectReturn(c *gin.Context) {
+	val, ok := c.Get("userId")
+	if !ok {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	actorId, err := uuid.Parse(val.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+
+	returnId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid return ID", err)
+		return
+	}
+
+	var req InspectReturnRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	rma, err := repository.GetReturnByID(returnId)
+	if err != nil {
+		respondReturnError(c, err)
+		return
+	}
+	if rma.Status != models.ReturnReceived {
+		utils.ResponseError(c, http.StatusConflict, "Illegal return transition", "return is "+string(rma.Status))
+		return
+	}
+
+	if !*req.Passed {
+		rma, err = repository.TransitionReturn(returnId, models.ReturnDeclined, actorId, req.Note, nil)
+		if err != nil {
+			respondReturnError(c, err)
+			return
+		}
+		auditReturnStep(c, rma)
+		utils.ResponseSuccess(c, http.StatusOK, "return declined", rma)
+		return
+	}
+
+	// the refund is attached to the return before it goes to the provider,
+	// a retry picks up the same refund instead of issuing another one
+	refund, created, err := repository.ClaimReturnRefund(returnId, actorId)
+	if err != nil {
+		if utils.IsNotFound(err) || errors.Is(err, repository.ErrInvalidReturnTransition) {
+			respondReturnError(c, err)
+		} else {
+			respondRefundError(c, nil, err)
+		}
+		return
+	}
+	if created {
+		auditRefund(c, models.AuditRefundCreate, nil, refund)
+	}
+
+	if refund.Status == models.RefundRequested {
+		before := refund
+		refund, err = payments.ProcessRefund(c.Request.Context(), refund.ID, actorId)
+		if refund != nil {
+			auditRefund(c, models.AuditRefundProcess, before, refund)
+		}
+		if err != nil {
+			respondRefundError(c, refund, err)
+			return
+		}
+	}
+	if refund.Status != models.RefundSucceeded {
+		utils.ResponseError(c, http.StatusConflict, "Refund not allowed", "the return's refund is "+string(refund.Status))
+		return
+	}
+
+	rma, err = repository.TransitionReturn(returnId, models.ReturnCompleted, actorId, req.Note, &refund.ID)
+	if err != nil {
+		respondReturnError(c, err)
+		return
+	}
+	auditReturnStep(c, rma)
+
+	utils.ResponseSuccess(c, http.StatusOK, "return completed", rma)
+}
+
+func advanceReturn(c *gin.Context, to models.ReturnStatus) {
+	val, ok := c.Get("userId")
+	if !ok {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	actorId, err := uuid.Parse(val.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+
+	returnId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid return ID", err)
+		return
+	}
+
+	// the note is optional, so an empty body is fine
+	var req ReturnStepRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+			return
+		}
+	}
+
+	rma, err := repository.TransitionReturn(returnId, to, actorId, req.Note, nil)
+	if err != nil {
+		respondReturnError(c, err)
+		return
+	}
+	auditReturnStep(c, rma)
+
+	utils.ResponseSuccess(c, http.StatusOK, "return "+string(to), rma)
+}
+
+// auditReturnStep records the step a return just took, its last event says where it came from
+func auditReturnStep(c *gin.Context, rma *models.ReturnRequest) {
+	before := map[string]interface{}{"status": nil}
+	metadata := map[string]interface{}{"order_id": rma.OrderID}
+	if n := len(rma.Events); n > 0 {
+		event := rma.Events[n-1]
+		if event.FromStatus != nil {
+			before["status"] = *event.FromStatus
+		}
+		if event.Note != "" {
+			metadata["note"] = event.Note
+		}
+	}
+
+	after := map[string]interface{}{"status": rma.Status}
+	if rma.RefundID != nil {
+		after["refund_id"] = *rma.RefundID
+	}
+	recordAudit(c, models.AuditReturnStatusChange, models.AuditTargetReturn, rma.ID.String(), before, after, metadata)
+}
+
+func respondReturnError(c *gin.Context, err error) {
+	switch {
+	case utils.IsNotFound(err):
+		utils.ResponseError(c, http.StatusNotFound, "Not found", nil)
+	case errors.Is(err, repository.ErrInvalidReturnItem):
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid return", err.Error())
+	case errors.Is(err, repository.ErrOrderNotReturnable),
+		errors.Is(err, repository.ErrReturnWindowClosed):
+		utils.ResponseError(c, http.StatusConflict, "Return not allowed", err.Error())
+	case errors.Is(err, repository.ErrInvalidReturnTransition):
+		utils.ResponseError(c, http.StatusConflict, "Illegal return transition", err.Error())
+	default:
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+	}
+}
+
+func returnWindow() time.Duration {
+	days, err := strconv.Atoi(config.LoadEnv().ReturnWindowDays)
+	if err != nil || days < 0 {
+		days = defaultReturnWindowDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
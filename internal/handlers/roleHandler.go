@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+)
+
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required" example:"seller"`
+}
+
+// GetRoles godoc
+// @Summary     List roles (Admin)
+// @Description List every role with the permissions it grants
+// @Tags        Roles
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}
+// @Failure     403  {object}  map[string]interface{}
+// @Failure     500  {object}  map[string]interface{}
+// @Router      /admin/roles [get]
+func GetRoles(c *gin.Context) {
+	roles, err := repository.GetRoles()
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", roles)
+}
+
+// GetUserRoles godoc
+// @Summary     List a user's roles (Admin)
+// @Tags        Roles
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id   path      string  true  "User UUID"
+// @Success     200  {object}  map[string]interface{}
+// @Failure     400  {object}  map[string]interface{}
+// @Failure     500  {object}  map[string]interface{}
+// @Router      /admin/users/{id}/roles [get]
+func GetUserRoles(c *gin.Context) {
+	userId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	roles, err := repository.GetUserRoles(userId)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", roles)
+}
+
+// AssignUserRole godoc
+// @Summary     Assign a role to a user (Admin)
+// @Description The user gets the new permissions right away; the roles claim updates on next login
+// @Tags        Roles
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id    path      string             true  "User UUID"
+// @Param       role  body      AssignRoleRequest  true  "Role"
+// @Success     200   {object}  map[string]interface{}
+// @Failure     400   {object}  map[string]interface{}
+// @Failure     404   {object}  map[string]interface{}
+// @Failure     500   {object}  map[string]interface{}
+// @Router      /admin/users/{id}/roles [post]
+func AssignUserRole(c *gin.Context) {
+	val, ok := c.Get("userId")
+	if !ok {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	actorId, err := uuid.Parse(val.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+
+	userId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	var req AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	if _, err := repository.GetUserByUUID(userId); err != nil {
+		utils.ResponseError(c, http.StatusNotFound, "User does not exist", nil)
+		return
+	}
+
+	before, _ := repository.GetUserRoleNames(userId)
+	if err := repository.AssignRole(userId, req.Role, &actorId); err != nil {
+		if errors.Is(err, repository.ErrUnknownRole) {
+			utils.ResponseError(c, http.StatusBadRequest, "Unknown role", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Failed to assign role", nil)
+		return
+	}
+	auditRoleChange(c, models.AuditRoleAssign, userId, req.Role, before)
+
+	utils.ResponseSuccess(c, http.StatusOK, "role assigned", nil)
+}
+
+// RevokeUserRole godoc
+// @Summary     Revoke a role from a user (Admin)
+// @Tags        Roles
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       id    path      string  true  "User UUID"
+// @Param       role  path      string  true  "Role name"
+// @Success     200   {object}  map[string]interface{}
+// @Failure     400   {object}  map[string]interface{}
+// @Failure     409   {object}  map[string]interface{}
+// @Failure     500   {object}  map[string]interface{}
+// @Router      /admin/users/{id}/roles/{role} [delete]
+func RevokeUserRole(c *gin.Context) {
+	val, ok := c.Get("userId")
+	if !ok {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	actorId, err := uuid.Parse(val.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+
+	userId, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	role := c.Param("role")
+	// keeps at least the acting admin around
+	if userId == actorId && role == models.RoleAdmin {
+		utils.ResponseError(c, http.StatusConflict, "You can't revoke your own admin role", nil)
+		return
+	}
+
+	before, _ := repository.GetUserRoleNames(userId)
+	if err := repository.RevokeRole(userId, role); err != nil {
+		if errors.Is(err, repository.ErrUnknownRole) {
+			utils.ResponseError(c, http.StatusBadRequest, "Unknown role", nil)
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Failed to revoke role", nil)
+		return
+	}
+	auditRoleChange(c, models.AuditRoleRevoke, userId, role, before)
+
+	utils.ResponseSuccess(c, http.StatusOK, "role revoked", nil)
+}
+
+// auditRoleChange records the user's roles before and after an assignment or revocation
+func auditRoleChange(c *gin.Context, action string, userID uuid.UUID, role string, before []string) {
+	after, _ := repository.GetUserRoleNames(userID)
+	recordAudit(c, action, models.AuditTargetUser, userID.String(),
+		map[string]interface{}{"roles": before}, map[string]interface{}{"roles": after},
+		map[string]interface{}{"role": role})
+}
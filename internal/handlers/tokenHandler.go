@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+)
+
+// RefreshTokenRequest - request body for refreshing tokens
+// @Description Refresh token payload
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// LogoutRequest - optional body for logout
+// @Description Logout payload
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// newRefreshToken builds an unsaved refresh token for this request, returning the raw value for the client
+func newRefreshToken(c *gin.Context) (*models.RefreshToken, string, error) {
+	raw, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+	return &models.RefreshToken{
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(utils.RefreshTokenTTL()),
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}, raw, nil
+}
+
+// issueTokens starts a new session (refresh token family) for the user
+func issueTokens(c *gin.Context, userID uuid.UUID, mfa bool) (gin.H, error) {
+	refresh, raw, err := newRefreshToken(c)
+	if err != nil {
+		return nil, err
+	}
+	refresh.UserID = userID
+	refresh.FamilyID = uuid.New()
+	refresh.MFA = mfa
+	if err := repository.CreateRefreshToken(refresh); err != nil {
+		return nil, err
+	}
+	return accessTokenResponse(userID, raw, mfa)
+}
+
+func accessTokenResponse(userID uuid.UUID, refreshToken string, mfa bool) (gin.H, error) {
+	roles, err := repository.GetUserRoleNames(userID)
+	if err != nil {
+		return nil, err
+	}
+	claims := utils.NewAccessClaims(userID.String(), roles)
+	claims.MFA = mfa
+	token, err := utils.CreateToken(claims)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(utils.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+// RefreshToken godoc
+// @Summary     Refresh access token
+// @Description Exchange a refresh token for a new access token and refresh token. Each refresh token works once; reusing one revokes the whole session.
+// @Tags        Auth
+// @Accept      json
+// @Produce     json
+// @Param       body  body      RefreshTokenRequest  true  "Refresh token"
+// @Success     200   {object}  map[string]interface{}
+// @Failure     400   {object}  map[string]interface{}
+// @Failure     401   {object}  map[string]interface{}
+// @Failure     500   {object}  map[string]interface{}
+// @Router      /users/token/refresh [post]
+func RefreshToken(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	next, raw, err := newRefreshToken(c)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "could not create token", nil)
+		return
+	}
+
+	current, err := repository.RotateRefreshToken(utils.HashToken(req.RefreshToken), next)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRefreshTokenInvalid),
+			errors.Is(err, repository.ErrRefreshTokenExpired),
+			errors.Is(err, repository.ErrRefreshTokenReused):
+			utils.ResponseError(c, http.StatusUnauthorized, err.Error(), nil)
+		default:
+			utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		}
+		return
+	}
+
+	// roles come from the database so changes since login are picked up
+	tokens, err := accessTokenResponse(current.UserID, raw, current.MFA)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "could not create token", nil)
+		return
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "token refreshed successfully", tokens)
+}
+
+// Logout godoc
+// @Summary     Log out
+// @Description Revoke the access token used for this request. Pass the refresh token to end that session too.
+// @Tags        Auth
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       body  body      LogoutRequest  false  "Refresh token of the session"
+// @Success     200   {object}  map[string]interface{}
+// @Failure     401   {object}  map[string]interface{}
+// @Failure     500   {object}  map[string]interface{}
+// @Router      /users/logout [post]
+func Logout(c *gin.Context) {
+	if rejectAPIKeySession(c) {
+		return
+	}
+	claims := c.MustGet("claims").(*utils.JWTClaims)
+
+	var req LogoutRequest
+	// the body is optional
+	_ = c.ShouldBindJSON(&req)
+
+	if err := utils.RevokeToken(c.Request.Context(), claims); err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+
+	if req.RefreshToken != "" {
+		token, err := repository.GetRefreshTokenByHash(utils.HashToken(req.RefreshToken))
+		// someone else's token is silently ignored
+		if err == nil && token.UserID.String() == claims.UserID {
+			if err := repository.RevokeRefreshTokenFamily(token.FamilyID); err != nil {
+				utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+				return
+			}
+		}
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "logged out successfully", nil)
+}
+
+// LogoutAll godoc
+// @Summary     Log out of all sessions
+// @Description Revoke every access and refresh token of the current user
+// @Tags        Auth
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}
+// @Failure     401  {object}  map[string]interface{}
+// @Failure     500  {object}  map[string]interface{}
+// @Router      /users/logout/all [post]
+func LogoutAll(c *gin.Context) {
+	if rejectDelegatedSession(c) {
+		return
+	}
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	if err := repository.RevokeAllUserRefreshTokens(userId); err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	if err := utils.RevokeAllUserTokens(c.Request.Context(), userId.String()); err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "logged out of all sessions", nil)
+}
+
+// setPassword is the only way a password should change: it hashes the new one
+// and revokes every refresh and access token of the user.
+func setPassword(ctx context.Context, userID uuid.UUID, password string) error {
+	hashed, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := repository.UpdatePassword(userID, hashed); err != nil {
+		return err
+	}
+	return revokeAccessTokens(ctx, userID)
+}
+
+// JWKS godoc
+// @Summary     JSON Web Key Set
+// @Description Public keys for verifying our access tokens, looked up by the kid header
+// @Tags        Auth
+// @Produce     json
+// @Success     200  {object}  utils.JWKSet
+// @Router      /.well-known/jwks.json [get]
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.PublicJWKS())
+}
@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	recoveryCodeCount = 10
+
+	mfaChallengeTTL         = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
+)
+
+var (
+	errInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	errChallengeInvalid     = errors.New("login challenge is invalid or has expired")
+)
+
+// TwoFactorCodeRequest - request body carrying an authenticator or recovery code
+// @Description Two-factor code payload
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+// DisableTwoFactorRequest - request body for turning 2FA off
+// @Description Disable two-factor payload
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// LoginTwoFactorRequest - second step of login
+// @Description Two-factor login payload
+type LoginTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required" example:"123456"`
+}
+
+// mfaChallenge is kept in Redis between the two login steps
+type mfaChallenge struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func mfaChallengeKey(token string) string {
+	return "mfa_challenge:" + utils.HashToken(token)
+}
+
+// mfaChallengeAttemptsKey counts the codes tried against a challenge
+func mfaChallengeAttemptsKey(token string) string {
+	return "mfa_challenge_attempts:" + utils.HashToken(token)
+}
+
+// startMFAChallenge is the first login step for users with 2FA: the password was right,
+// the returned token has to be sent back with a code within a few minutes
+func startMFAChallenge(ctx context.Context, userID uuid.UUID) (string, error) {
+	raw, _, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	data, _ := json.Marshal(mfaChallenge{UserID: userID})
+	if err := config.RDB.Set(ctx, mfaChallengeKey(raw), data, mfaChallengeTTL).Err(); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// verifySecondFactor accepts either a current authenticator code or an unused recovery code
+func verifySecondFactor(userID uuid.UUID, code string) error {
+	if len(code) == 6 {
+		totp, err := repository.GetUserTOTP(userID)
+		if err != nil {
+			if utils.IsNotFound(err) {
+				return repository.ErrTwoFactorNotEnabled
+			}
+			return err
+		}
+		if !totp.Enabled() {
+			return repository.ErrTwoFactorNotEnabled
+		}
+		secret, err := utils.DecryptSecret(config.LoadEnv().MFASecretKey, totp.SecretEncrypted)
+		if err != nil {
+			return err
+		}
+		step, ok := utils.ValidateTOTP(secret, code, time.Now())
+		if !ok {
+			return errInvalidTwoFactorCode
+		}
+		return repository.UseTOTPStep(userID, step)
+	}
+
+	err := repository.UseRecoveryCode(userID, utils.HashToken(utils.NormalizeRecoveryCode(code)))
+	if errors.Is(err, repository.ErrInvalidRecoveryCode) {
+		return errInvalidTwoFactorCode
+	}
+	return err
+}
+
+// newRecoveryCodes returns the codes to show the user once and the hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashToken(utils.NormalizeRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func respondTwoFactorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errInvalidTwoFactorCode), errors.Is(err, repository.ErrTOTPCodeReused):
+		utils.ResponseError(c, http.StatusUnauthorized, err.Error(), nil)
+	case errors.Is(err, repository.ErrTwoFactorEnabled):
+		utils.ResponseError(c, http.StatusConflict, err.Error(), nil)
+	case errors.Is(err, repository.ErrTwoFactorNotEnabled), errors.Is(err, repository.ErrTwoFactorNotEnrolled):
+		utils.ResponseError(c, http.StatusBadRequest, err.Error(), nil)
+	default:
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+	}
+}
+
+// EnrollTwoFactor godoc
+// @Summary     Start 2FA enrollment
+// @Description Create an authenticator secret. Scan the otpauth URI, then confirm with a code.
+// @Tags        Auth
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Success     200  {object}  map[string]interface{}
+// @Failure     401  {object}  map[string]interface{}
+// @Failure     409  {object}  map[string]interface{}
+// @Failure     500  {object}  map[string]interface{}
+// @Router      /users/2fa/enroll [post]
+func EnrollTwoFactor(c *gin.Context) {
+	if rejectDelegatedSession(c) {
+		return
+	}
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+	user, err := repository.GetUserByUUID(userId)
+	if err != nil {
+		utils.ResponseError(c, http.StatusNotFound, "User not found", nil)
+		return
+	}
+
+	env := config.LoadEnv()
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	encrypted, err := utils.EncryptSecret(env.MFASecretKey, secret)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "two-factor authentication is not configured", nil)
+		return
+	}
+	if err := repository.SaveUnconfirmedTOTP(userId, encrypted); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	issuer := env.TOTPIssuer
+	if issuer == "" {
+		issuer = "e-commerce-app"
+	}
+	utils.ResponseSuccess(c, http.StatusOK, "scan the code and confirm it to enable two-factor authentication", gin.H{
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPURI(issuer, user.Email, secret),
+	})
+}
+
+// ConfirmTwoFactor godoc
+// @Summary     Confirm 2FA enrollment
+// @Description Enable 2FA with a first authenticator code. The recovery codes are only shown in this response.
+// @Tags        Auth
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       body  body      TwoFactorCodeRequest  true  "Authenticator code"
+// @Success     200   {object}  map[string]interface{}
+// @Failure     400   {object}  map[string]interface{}
+// @Failure     401   {object}  map[string]interface{}
+// @Failure     409   {object}  map[string]interface{}
+// @Router      /users/2fa/verify [post]
+func ConfirmTwoFactor(c *gin.Context) {
+	if rejectDelegatedSession(c) {
+		return
+	}
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	totp, err := repository.GetUserTOTP(userId)
+	if err != nil {
+		if utils.IsNotFound(err) {
+			respondTwoFactorError(c, repository.ErrTwoFactorNotEnrolled)
+			return
+		}
+		respondTwoFactorError(c, err)
+		return
+	}
+	if totp.Enabled() {
+		respondTwoFactorError(c, repository.ErrTwoFactorEnabled)
+		return
+	}
+	secret, err := utils.DecryptSecret(config.LoadEnv().MFASecretKey, totp.SecretEncrypted)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	step, ok := utils.ValidateTOTP(secret, req.Code, time.Now())
+	if !ok {
+		respondTwoFactorError(c, errInvalidTwoFactorCode)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	if err := repository.ConfirmTOTP(userId, step, hashes); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "two-factor authentication enabled, log in again to use it", gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary     New recovery codes
+// @Description Replace all recovery codes. Needs a current authenticator code.
+// @Tags        Auth
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       body  body      TwoFactorCodeRequest  true  "Authenticator code"
+// @Success     200   {object}  map[string]interface{}
+// @Failure     400   {object}  map[string]interface{}
+// @Failure     401   {object}  map[string]interface{}
+// @Router      /users/2fa/recovery-codes [post]
+func RegenerateRecoveryCodes(c *gin.Context) {
+	if rejectDelegatedSession(c) {
+		return
+	}
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+	if err := verifySecondFactor(userId, req.Code); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	if err := repository.ReplaceRecoveryCodes(userId, hashes); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "recovery codes replaced", gin.H{"recovery_codes": codes})
+}
+
+// DisableTwoFactor godoc
+// @Summary     Disable 2FA
+// @Description Turn off two-factor authentication. Needs the password and an authenticator or recovery code.
+// @Tags        Auth
+// @Accept      json
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       body  body      DisableTwoFactorRequest  true  "Password and code"
+// @Success     200   {object}  map[string]interface{}
+// @Failure     400   {object}  map[string]interface{}
+// @Failure     401   {object}  map[string]interface{}
+// @Router      /users/2fa/disable [post]
+func DisableTwoFactor(c *gin.Context) {
+	if rejectDelegatedSession(c) {
+		return
+	}
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	user, err := repository.GetUserByUUID(userId)
+	if err != nil || !utils.CheckPassword(user.Password, req.Password) {
+		utils.ResponseError(c, http.StatusUnauthorized, "Invalid Credential", nil)
+		return
+	}
+	if err := verifySecondFactor(userId, req.Code); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	if err := repository.DisableTOTP(userId); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, http.StatusOK, "two-factor authentication disabled", nil)
+}
+
+// LoginTwoFactor godoc
+// @Summary     Complete login with 2FA
+// @Description Second login step: exchange the challenge token from /users/login and a code for the JWT
+// @Tags        Auth
+// @Accept      json
+// @Produce     json
+// @Param       body  body      LoginTwoFactorRequest  true  "Challenge token and code"
+// @Success     200   {object}  map[string]interface{}
+// @Failure     400   {object}  map[string]interface{}
+// @Failure     401   {object}  map[string]interface{}
+// @Failure     500   {object}  map[string]interface{}
+// @Router      /users/login/2fa [post]
+func LoginTwoFactor(c *gin.Context) {
+	var req LoginTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	key := mfaChallengeKey(req.ChallengeToken)
+	raw, err := config.RDB.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		utils.ResponseError(c, http.StatusUnauthorized, errChallengeInvalid.Error(), nil)
+		return
+	}
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	var challenge mfaChallenge
+	if err := json.Unmarshal(raw, &challenge); err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, errChallengeInvalid.Error(), nil)
+		return
+	}
+
+	// a challenge only allows a few guesses, then the password is needed again.
+	// The attempt is counted before the code is checked so parallel guesses can't get around it.
+	attemptsKey := mfaChallengeAttemptsKey(req.ChallengeToken)
+	attempts, err := config.RDB.Incr(ctx, attemptsKey).Result()
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
+	}
+	if attempts == 1 {
+		config.RDB.Expire(ctx, attemptsKey, mfaChallengeTTL)
+	}
+	if attempts > mfaChallengeMaxAttempts {
+		config.RDB.Del(ctx, key)
+		utils.ResponseError(c, http.StatusUnauthorized, errChallengeInvalid.Error(), nil)
+		return
+	}
+
+	if err := verifySecondFactor(challenge.UserID, req.Code); err != nil {
+		if attempts == mfaChallengeMaxAttempts {
+			config.RDB.Del(ctx, key)
+		}
+		respondTwoFactorError(c, err)
+		return
+	}
+	// the challenge is single-use
+	if deleted, err := config.RDB.Del(ctx, key).Result(); err != nil || deleted == 0 {
+		utils.ResponseError(c, http.StatusUnauthorized, errChallengeInvalid.Error(), nil)
+		return
+	}
+
+	user, err := repository.GetUserByUUID(challenge.UserID)
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "Invalid Credential", nil)
+		return
+	}
+	// suspended while the challenge was open
+	if user.SuspendedAt != nil {
+		utils.ResponseError(c, http.StatusForbidden, repository.ErrAccountSuspended.Error(), nil)
+		return
+	}
+	tokens, err := issueTokens(c, user.ID, true)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "could not create token", nil)
+		return
+	}
+	tokens["data"] = utils.ToUserResponse(user)
+	utils.ResponseSuccess(c, http.StatusOK, "loggedin successfully", tokens)
+}
@@ -1,12 +1,12 @@
 package handlers
 
 import (
+	"context"
+	"log"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/helper"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
@@ -73,6 +73,15 @@ func Register(c *gin.Context) {
 		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", err.Error())
 		return
 	}
+	if err := repository.AssignRole(userData.ID, models.RoleCustomer, nil); err != nil {
+		log.Printf("failed to assign customer role to %s: %v", userData.ID, err)
+	}
+	// the account is created either way, the user can ask for another link
+	go func(user models.User) {
+		if err := sendVerificationEmail(context.Background(), &user); err != nil {
+			log.Printf("verification mail to %s failed: %v", user.ID, err)
+		}
+	}(*userData)
 	userResponse := utils.ToUserResponse(userData)
 	utils.ResponseSuccess(c, http.StatusOK, "user registered successfully", userResponse)
 
@@ -80,13 +89,16 @@ func Register(c *gin.Context) {
 
 // Login godoc
 // @Summary     User login
-// @Description Authenticate user and return JWT token
+// @Description Authenticate user and return a short-lived JWT plus a refresh token. With 2FA enabled a challenge token is returned instead, see /users/login/2fa.
 // @Tags        Auth
 // @Accept      json
 // @Produce     json
 // @Param       credentials  body      LoginRequest  true  "Login credentials"
 // @Success     200          {object}  map[string]interface{}
 // @Failure     400          {object}  map[string]interface{}
+// @Failure     401          {object}  map[string]interface{}
+// @Failure     423          {object}  map[string]interface{}
+// @Failure     429          {object}  map[string]interface{}
 // @Failure     500          {object}  map[string]interface{}
 // @Router      /users/login [post]
 func Login(c *gin.Context) {
@@ -96,46 +108,80 @@ func Login(c *gin.Context) {
 		utils.ResponseError(c, http.StatusBadRequest, "Validation failed", err.Error())
 		return
 	}
+	if !allowLoginAttempt(c, req.Email) {
+		return
+	}
 
 	user, err := repository.GetUserByEmail(req.Email)
 	if err != nil {
+		if utils.IsNotFound(err) {
+			loginFailed(c, req.Email, nil)
+		} else {
+			loginAborted(c, req.Email)
+		}
 		utils.ResponseError(c, http.StatusBadRequest, "Invalid Credential", nil)
 		return
 	}
 
-	if isPasswordValid := utils.CheckPassword(req.Password, user.Password); isPasswordValid == false {
+	if isPasswordValid := utils.CheckPassword(user.Password, req.Password); isPasswordValid == false {
+		loginFailed(c, req.Email, user)
 		utils.ResponseError(c, http.StatusUnauthorized, "Invalid Credential", nil)
 		return
 	}
-	claims := utils.JWTClaims{
-		UserID: user.ID.String(),
-		Roles:  []string{"user", "admin"}, // dynamic from DB
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "e-commerce-app",
-		},
+	if err := utils.ResetLoginFailures(c.Request.Context(), req.Email, c.ClientIP()); err != nil {
+		log.Println("Failed to reset login failures:", err)
+	}
+	if user.PasswordResetRequired {
+		utils.ResponseError(c, http.StatusForbidden, "password reset required, use the link we emailed or request a new one", nil)
+		return
+	}
+	finishLogin(c, user)
+}
+
+// finishLogin runs once the first factor (password or identity provider) checked out.
+// With 2FA on, it only gets the user to the second step.
+func finishLogin(c *gin.Context, user *models.User) {
+	if user.SuspendedAt != nil {
+		utils.ResponseError(c, http.StatusForbidden, repository.ErrAccountSuspended.Error(), nil)
+		return
+	}
+	mfaEnabled, err := repository.IsTwoFactorEnabled(user.ID)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+		return
 	}
-	token, err := utils.CreateToken(claims)
+	if mfaEnabled {
+		challenge, err := startMFAChallenge(c.Request.Context(), user.ID)
+		if err != nil {
+			utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+			return
+		}
+		utils.ResponseSuccess(c, http.StatusOK, "two-factor code required", gin.H{
+			"mfa_required":    true,
+			"challenge_token": challenge,
+			"expires_in":      int(mfaChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	tokens, err := issueTokens(c, user.ID, false)
 	if err != nil {
 		utils.ResponseError(c, http.StatusInternalServerError, "could not create token", nil)
 		return
 	}
-	userResponse := utils.ToUserResponse(user)
-	utils.ResponseSuccess(c, http.StatusOK, "loggedin successfully", gin.H{
-		"data":  userResponse,
-		"token": token,
-	})
+	tokens["data"] = utils.ToUserResponse(user)
+	utils.ResponseSuccess(c, http.StatusOK, "loggedin successfully", tokens)
 }
 
 // GetAllUsers godoc
-// @Summary     Get all users
-// @Description Retrieve list of all users (requires auth)
+// @Summary     Get all users (Admin)
+// @Description Retrieve list of all users
 // @Tags        Users
 // @Accept      json
 // @Produce     json
 // @Security    ApiKeyAuth
 // @Success     200  {object}  map[string]interface{}
+// @Failure     403  {object}  map[string]interface{}
 // @Failure     500  {object}  map[string]interface{}
 // @Router      /users/all [get]
 func GetAllUsers(c *gin.Context) {
@@ -148,7 +194,7 @@ func GetAllUsers(c *gin.Context) {
 }
 
 // GetUser godoc
-// @Summary     Get user by ID
+// @Summary     Get user by ID (Admin)
 // @Description Retrieve a single user by UUID
 // @Tags        Users
 // @Accept      json
@@ -157,6 +203,7 @@ func GetAllUsers(c *gin.Context) {
 // @Param       id   path      string  true  "User UUID"
 // @Success     200  {object}  map[string]interface{}
 // @Failure     400  {object}  map[string]interface{}
+// @Failure     403  {object}  map[string]interface{}
 // @Failure     404  {object}  map[string]interface{}
 // @Router      /users/user/{id} [get]
 func GetUser(c *gin.Context) {
@@ -177,7 +224,7 @@ func GetUser(c *gin.Context) {
 }
 
 // GetUserByEmail godoc
-// @Summary     Get user by email
+// @Summary     Get user by email (Admin)
 // @Description Retrieve a user by email query param
 // @Tags        Users
 // @Accept      json
@@ -185,6 +232,7 @@ func GetUser(c *gin.Context) {
 // @Security    ApiKeyAuth
 // @Param       email  query     string  true  "User email"
 // @Success     200    {object}  map[string]interface{}
+// @Failure     403    {object}  map[string]interface{}
 // @Failure     404    {object}  map[string]interface{}
 // @Router      /users/user [get]
 func GetUserByEmail(c *gin.Context) {
@@ -198,6 +246,23 @@ func GetUserByEmail(c *gin.Context) {
 	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", user)
 }
 
+// GetFilterAndSearchUsers godoc
+// @Summary     Search users (Admin)
+// @Description Filter users by name or username, email, a product they ordered and account status. Newest first.
+// @Tags        Users
+// @Produce     json
+// @Security    ApiKeyAuth
+// @Param       name     query     string  false  "Part of the full name or username"
+// @Param       email    query     string  false  "Part of the email"
+// @Param       product  query     string  false  "Part of the name of a product the user ordered"
+// @Param       status   query     string  false  "active or suspended"
+// @Param       page     query     int     false  "Page number"  default(1)
+// @Param       limit    query     int     false  "Page size (max 100)"  default(10)
+// @Success     200      {object}  map[string]interface{}
+// @Failure     400      {object}  map[string]interface{}
+// @Failure     403      {object}  map[string]interface{}
+// @Failure     500      {object}  map[string]interface{}
+// @Router      /admin/users [get]
 func GetFilterAndSearchUsers(c *gin.Context) {
 	// 1. Parse and set defaults for pagination
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
@@ -209,11 +274,22 @@ func GetFilterAndSearchUsers(c *gin.Context) {
 	if limit < 1 {
 		limit = 10
 	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	status := helper.UserStatus(c.Query("status"))
+	if status != "" && status != helper.UserStatusActive && status != helper.UserStatusSuspended {
+		utils.ResponseError(c, http.StatusBadRequest, "status must be active or suspended", nil)
+		return
+	}
 
 	// 2. Create the params object
 	params := helper.UserFilterParams{
-		ProductName: c.Query("productName"),
-		FullName:    c.Query("fullname"),
+		ProductName: c.Query("product"),
+		Name:        c.Query("name"),
+		Email:       c.Query("email"),
+		Status:      status,
 		Page:        page,
 		Limit:       limit,
 	}
@@ -222,9 +298,14 @@ func GetFilterAndSearchUsers(c *gin.Context) {
 		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
 		return
 	}
+
+	results := make([]AdminUserResponse, 0, len(*users))
+	for i := range *users {
+		results = append(results, toAdminUserResponse(&(*users)[i]))
+	}
 	// 3. Return response with metadata
 	utils.ResponseSuccess(c, http.StatusOK, "data fetched successfully", gin.H{
-		"users": users,
+		"users": results,
 		"meta": gin.H{
 			"page":  page,
 			"limit": limit,
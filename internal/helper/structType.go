@@ -2,7 +2,9 @@ package helper
 
 import (
 	"mime/multipart"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 )
 
@@ -27,9 +29,75 @@ type CreateProductRequest struct {
 	DiscountPercent decimal.Decimal         `form:"discount_percent" validate:"gte=0,lte=100"`
 	ImageFiles      []*multipart.FileHeader `form:"images"`
 }
+type UserStatus string
+
+const (
+	UserStatusActive    UserStatus = "active"
+	UserStatusSuspended UserStatus = "suspended"
+)
+
 type UserFilterParams struct {
 	ProductName string
-	FullName    string
+	Name        string // full name or username
+	Email       string
+	Status      UserStatus // empty matches every user
 	Page        int
 	Limit       int
 }
+
+type OrderFilterParams struct {
+	UserID *uuid.UUID // nil means every user (admin only)
+	Status string
+	From   *time.Time
+	To     *time.Time // exclusive
+	Page   int
+	Limit  int
+}
+
+type AuditLogFilterParams struct {
+	ActorID    *uuid.UUID
+	Action     string
+	TargetType string
+	TargetID   string
+	RequestID  string
+	From       *time.Time
+	To         *time.Time // exclusive
+	Page       int
+	Limit      int
+}
+
+type RefundItemParams struct {
+	OrderItemID uuid.UUID
+	Quantity    int
+}
+
+type RefundParams struct {
+	OrderID uuid.UUID
+	ActorID uuid.UUID
+	Amount  decimal.Decimal    // used when Items is empty
+	Items   []RefundItemParams // refund specific items, the amount is derived from what was paid for them
+	Reason  string
+	Restock bool
+}
+
+type ReturnItemParams struct {
+	OrderItemID uuid.UUID
+	Quantity    int
+	Reason      string
+}
+
+// ProfileUpdateParams holds the fields a user changes about themselves, nil means unchanged
+type ProfileUpdateParams struct {
+	Fullname *string
+	Username *string
+	Email    *string
+}
+
+// CheckoutAddressParams selects address book entries for an order, nil uses the user's default
+type CheckoutAddressParams struct {
+	ShippingAddressID *uuid.UUID
+	BillingAddressID  *uuid.UUID
+	// RequireShipping fails the checkout with ErrShippingAddressMissing instead of
+	// placing the order without a shipping address
+	RequireShipping bool
+}
@@ -0,0 +1,62 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+)
+
+const (
+	ConsoleMailerName = "console"
+	FileMailerName    = "file"
+)
+
+// ConsoleMailer prints every message to the log, for development
+type ConsoleMailer struct{}
+
+func (m *ConsoleMailer) Name() string { return ConsoleMailerName }
+
+func (m *ConsoleMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("📧 mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer writes every message as an .eml file into MAIL_DIR ("mail" when unset),
+// so dev and test setups can read what would have been sent
+type FileMailer struct {
+	Dir string
+}
+
+func (m *FileMailer) Name() string { return FileMailerName }
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	dir := m.Dir
+	if dir == "" {
+		dir = config.LoadEnv().MailDir
+	}
+	if dir == "" {
+		dir = "mail"
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%s_%s.eml", now.Format("20060102T150405"), uuid.NewString())
+	content := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s\r\n",
+		fromAddress(), msg.To, msg.Subject, now.Format(time.RFC1123Z), msg.Body)
+	return os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+}
+
+func fromAddress() string {
+	if from := config.LoadEnv().MailFrom; from != "" {
+		return from
+	}
+	return "no-reply@localhost"
+}
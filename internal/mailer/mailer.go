@@ -0,0 +1,68 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+)
+
+var ErrUnknownMailer = errors.New("unknown mailer")
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string // plain text
+}
+
+// Mailer is implemented by every way of sending mail (console, file, SMTP, an API...)
+type Mailer interface {
+	Name() string
+	Send(ctx context.Context, msg Message) error
+}
+
+var (
+	mailersMu sync.RWMutex
+	mailers   = map[string]Mailer{}
+)
+
+func Register(m Mailer) {
+	mailersMu.Lock()
+	defer mailersMu.Unlock()
+	mailers[m.Name()] = m
+}
+
+func Get(name string) (Mailer, error) {
+	mailersMu.RLock()
+	defer mailersMu.RUnlock()
+	m, ok := mailers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMailer, name)
+	}
+	return m, nil
+}
+
+// Default returns the mailer configured by MAIL_DRIVER (console when unset)
+func Default() (Mailer, error) {
+	name := config.LoadEnv().MailDriver
+	if name == "" {
+		name = ConsoleMailerName
+	}
+	return Get(name)
+}
+
+// Send delivers through the default mailer
+func Send(ctx context.Context, msg Message) error {
+	m, err := Default()
+	if err != nil {
+		return err
+	}
+	return m.Send(ctx, msg)
+}
+
+func init() {
+	Register(&ConsoleMailer{})
+	Register(&FileMailer{})
+}
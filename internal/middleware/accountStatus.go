@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+)
+
+// ImpersonationHeader is set on every response to a request made with an impersonation token
+const ImpersonationHeader = "X-Impersonated-By"
+
+// requireActiveAccount aborts the request when the account was suspended or erased
+// after the token or API key was issued
+func requireActiveAccount(c *gin.Context, userID string) bool {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		utils.ResponseError(c, http.StatusUnauthorized, "invalid or expired token", nil)
+		c.Abort()
+		return false
+	}
+
+	err = repository.CheckAccountActive(id)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, repository.ErrAccountSuspended):
+		utils.ResponseError(c, http.StatusForbidden, err.Error(), nil)
+	case errors.Is(err, repository.ErrAccountUnavailable):
+		utils.ResponseError(c, http.StatusUnauthorized, err.Error(), nil)
+	default:
+		utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+	}
+	c.Abort()
+	return false
+}
+
+// GetImpersonator returns the admin acting through an impersonation token, empty otherwise
+func GetImpersonator(c *gin.Context) string {
+	return c.GetString("impersonatorId")
+}
+
+// auditImpersonatedRequest records every change made while impersonating.
+// Reads aren't recorded, starting the impersonation already was.
+func auditImpersonatedRequest(c *gin.Context, claims *utils.JWTClaims) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return
+	}
+
+	actorID, err := uuid.Parse(claims.Impersonator())
+	if err != nil {
+		return
+	}
+	if err := repository.RecordAudit(models.AuditLog{
+		ActorID:    &actorID,
+		Action:     models.AuditImpersonationRequest,
+		TargetType: models.AuditTargetUser,
+		TargetID:   claims.UserID,
+		IP:         c.ClientIP(),
+		RequestID:  GetRequestID(c),
+	}, map[string]interface{}{
+		"method": c.Request.Method,
+		"path":   c.Request.URL.Path,
+		"status": c.Writer.Status(),
+		"jti":    claims.ID,
+	}); err != nil {
+		log.Println("Failed to audit impersonated request:", err)
+	}
+}
@@ -2,10 +2,14 @@ package middleware
 
 import (
 	"errors"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
 )
 
@@ -30,8 +34,14 @@ func GetClaims(c *gin.Context) (*utils.JWTClaims, error) {
 	return claims, nil
 }
 
+// AuthMiddleware accepts a Bearer JWT or an API key, see apiKeyFromRequest
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if key := apiKeyFromRequest(c); key != "" {
+			authenticateAPIKey(c, key)
+			return
+		}
+
 		// auth logic
 		claims, err := GetClaims(c)
 		if err != nil {
@@ -39,32 +49,109 @@ func AuthMiddleware() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+		// fail closed: a revoked token must not get through while Redis is unreachable
+		revoked, err := utils.IsTokenRevoked(c.Request.Context(), claims)
+		if err != nil {
+			utils.ResponseError(c, http.StatusServiceUnavailable, "could not verify token", nil)
+			c.Abort()
+			return
+		}
+		if revoked {
+			utils.ResponseError(c, http.StatusUnauthorized, "token has been revoked", nil)
+			c.Abort()
+			return
+		}
+		if !requireActiveAccount(c, claims.UserID) {
+			return
+		}
+		impersonator := claims.Impersonator()
+		// the admin behind an impersonation token must still be allowed in as well
+		if impersonator != "" && !requireActiveAccount(c, impersonator) {
+			return
+		}
 		// store values for handlers
 		c.Set("claims", claims)
 		c.Set("userId", claims.UserID)
 		c.Set("roles", claims.Roles)
+		if impersonator == "" {
+			c.Next()
+			return
+		}
+
+		c.Set("impersonatorId", impersonator)
+		c.Header(ImpersonationHeader, impersonator)
 		c.Next()
+		auditImpersonatedRequest(c, claims)
 	}
 }
 
-func IsAuthorized(requiredRole string) gin.HandlerFunc {
+// HasPermission reports whether the request may use the permission, by the same rules as RequirePermission.
+// Handlers use it where a permission widens what the caller sees, e.g. other users' orders.
+// A failed lookup counts as not allowed.
+func HasPermission(c *gin.Context, permission string) bool {
+	userId, err := uuid.Parse(c.GetString("userId"))
+	if err != nil {
+		return false
+	}
+	if key := GetAPIKey(c); key != nil && !key.HasScope(permission) {
+		return false
+	}
+	if models.TwoFactorPermissions[permission] {
+		claimsAny, _ := c.Get("claims")
+		claims, _ := claimsAny.(*utils.JWTClaims)
+		if claims == nil || !claims.MFA {
+			return false
+		}
+	}
+
+	allowed, err := repository.UserHasPermission(userId, permission)
+	if err != nil {
+		log.Printf("permission check for %s failed: %v", permission, err)
+		return false
+	}
+	return allowed
+}
+
+// RequirePermission lets the request through only if one of the user's roles grants
+// the permission. Roles are read from the database, not the token, so revocations apply at once.
+// Must run after AuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		claimsAny, exists := c.Get("claims")
-		// Roles, exists := c.Get("roles")
-		if !exists {
+		userId, err := uuid.Parse(c.GetString("userId"))
+		if err != nil {
 			utils.ResponseError(c, http.StatusUnauthorized, "unauthenticated", nil)
 			c.Abort()
 			return
 		}
-		claims := claimsAny.(*utils.JWTClaims)
-		for _, role := range claims.Roles {
-			if requiredRole == role {
-				c.Next()
+
+		if key := GetAPIKey(c); key != nil && !key.HasScope(permission) {
+			utils.ResponseError(c, http.StatusForbidden, "API key is missing a scope", gin.H{"missing_scope": permission})
+			c.Abort()
+			return
+		}
+
+		if models.TwoFactorPermissions[permission] {
+			claimsAny, _ := c.Get("claims")
+			claims, _ := claimsAny.(*utils.JWTClaims)
+			if claims == nil || !claims.MFA {
+				utils.ResponseError(c, http.StatusForbidden, "two-factor authentication required", gin.H{"missing_permission": permission})
+				c.Abort()
 				return
 			}
 		}
 
-		utils.ResponseError(c, http.StatusForbidden, "access denied", nil)
-		c.Abort()
+		allowed, err := repository.UserHasPermission(userId, permission)
+		if err != nil {
+			utils.ResponseError(c, http.StatusInternalServerError, "Something went wrong", nil)
+			c.Abort()
+			return
+		}
+		if !allowed {
+			utils.ResponseError(c, http.StatusForbidden, "access denied", gin.H{"missing_permission": permission})
+			c.Abort()
+			return
+		}
+
+		c.Next()
 	}
 }
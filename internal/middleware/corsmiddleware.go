@@ -20,7 +20,8 @@ func CORSMiddleware() gin.HandlerFunc {
 		}
 		c.Writer.Header().Set("Access-Control-Max-Age", "86400")
 		c.Writer.Header().Set("Access-Control-Allow-Headers",
-			"Content-Type, Authorization, Origin, Accept")
+			"Content-Type, Authorization, Origin, Accept, Idempotency-Key, X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 		c.Writer.Header().Set("Access-Control-Allow-Methods",
 			"GET, POST, PUT, PATCH, DELETE, OPTIONS")
 
@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+const IdempotencyHeader = "Idempotency-Key"
+
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// idempotencyInFlightTTL bounds how long a key stays locked by a request that never finished,
+// e.g. because the process died. The key gets the full TTL once the response is stored.
+const idempotencyInFlightTTL = 2 * time.Minute
+
+type idempotencyState string
+
+const (
+	idempotencyInFlight  idempotencyState = "in_flight"
+	idempotencyCompleted idempotencyState = "completed"
+)
+
+// idempotencyRecord is what we keep in Redis for each key
+type idempotencyRecord struct {
+	State       idempotencyState `json:"state"`
+	RequestHash string           `json:"request_hash"`
+	StatusCode  int              `json:"status_code,omitempty"`
+	ContentType string           `json:"content_type,omitempty"`
+	Body        []byte           `json:"body,omitempty"`
+}
+
+// responseRecorder keeps a copy of everything the handler writes
+type responseRecorder struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware stores the first response for an Idempotency-Key (per user and route)
+// and replays it on retries. A retry that arrives while the first request is still running
+// gets 409, and reusing a key with a different payload gets 422.
+// Requests without the header pass through untouched. Must run after AuthMiddleware.
+func IdempotencyMiddleware() gin.HandlerFunc {
+	ttl := defaultIdempotencyTTL
+	if raw := config.LoadEnv().IdempotencyTTL; raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+			ttl = d
+		} else {
+			log.Printf("invalid IDEMPOTENCY_TTL %q, using %s", raw, defaultIdempotencyTTL)
+		}
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > 255 {
+			utils.ResponseError(c, http.StatusBadRequest, "Idempotency-Key is too long", nil)
+			c.Abort()
+			return
+		}
+
+		ctx := c.Request.Context()
+		userId := c.GetString("userId")
+		cacheKey := fmt.Sprintf("idempotency:%s:%s:%s:%s", userId, c.Request.Method, c.FullPath(), key)
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			utils.ResponseError(c, http.StatusBadRequest, "Invalid request body", nil)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		requestHash := hex.EncodeToString(sum[:])
+
+		pending, _ := json.Marshal(idempotencyRecord{State: idempotencyInFlight, RequestHash: requestHash})
+		acquired, err := config.RDB.SetNX(ctx, cacheKey, pending, idempotencyInFlightTTL).Result()
+		if err != nil {
+			// Redis might be down, don't block the request
+			log.Println("Idempotency check failed:", err)
+			c.Next()
+			return
+		}
+
+		if !acquired {
+			replayIdempotentResponse(c, cacheKey, requestHash)
+			return
+		}
+
+		// the client may hang up while the handler runs, the key still has to be settled
+		storeCtx := context.WithoutCancel(ctx)
+		settled := false
+		defer func() {
+			// the handler failed or panicked, free the key so the client can retry
+			if settled {
+				return
+			}
+			if err := config.RDB.Del(storeCtx, cacheKey).Err(); err != nil {
+				log.Println("Failed to release idempotency key:", err)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = recorder
+		c.Next()
+
+		// server errors are not cached so the client can retry with the same key
+		if recorder.Status() >= http.StatusInternalServerError {
+			return
+		}
+
+		done, _ := json.Marshal(idempotencyRecord{
+			State:       idempotencyCompleted,
+			RequestHash: requestHash,
+			StatusCode:  recorder.Status(),
+			ContentType: recorder.Header().Get("Content-Type"),
+			Body:        recorder.body.Bytes(),
+		})
+		// the request went through, if storing fails the in-flight marker just runs out
+		settled = true
+		if err := config.RDB.Set(storeCtx, cacheKey, done, ttl).Err(); err != nil {
+			log.Println("Failed to store idempotent response:", err)
+		}
+	}
+}
+
+func replayIdempotentResponse(c *gin.Context, cacheKey string, requestHash string) {
+	raw, err := config.RDB.Get(c.Request.Context(), cacheKey).Bytes()
+	if err == redis.Nil {
+		// expired between SETNX and GET, treat it as a concurrent duplicate
+		utils.ResponseError(c, http.StatusConflict, "A request with this Idempotency-Key is already in progress", nil)
+		c.Abort()
+		return
+	}
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Failed to read idempotency key", nil)
+		c.Abort()
+		return
+	}
+
+	var record idempotencyRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, "Failed to read idempotency key", nil)
+		c.Abort()
+		return
+	}
+
+	if record.RequestHash != requestHash {
+		utils.ResponseError(c, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request", nil)
+		c.Abort()
+		return
+	}
+
+	if record.State == idempotencyInFlight {
+		utils.ResponseError(c, http.StatusConflict, "A request with this Idempotency-Key is already in progress", nil)
+		c.Abort()
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(record.StatusCode, record.ContentType, record.Body)
+	c.Abort()
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+)
+
+// RequireVerifiedEmail rejects users who haven't confirmed their email, when REQUIRE_VERIFIED_EMAIL
+// is on. The flag is read once when routes are set up. Must run after AuthMiddleware.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	required, _ := strconv.ParseBool(config.LoadEnv().RequireVerifiedEmail)
+	if !required {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		userId, err := uuid.Parse(c.GetString("userId"))
+		if err != nil {
+			utils.ResponseError(c, http.StatusUnauthorized, "unauthenticated", nil)
+			c.Abort()
+			return
+		}
+
+		user, err := repository.GetUserByUUID(userId)
+		if err != nil {
+			utils.ResponseError(c, http.StatusUnauthorized, "unauthenticated", nil)
+			c.Abort()
+			return
+		}
+		if user.EmailVerifiedAt == nil {
+			utils.ResponseError(c, http.StatusForbidden, "please verify your email address first", nil)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
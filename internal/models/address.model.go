@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserAddress is an entry in a customer's address book. At most one address per user
+// is the default for shipping and one for billing, see repository.CreateAddress and UpdateAddress.
+type UserAddress struct {
+	ID         uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID     uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	Label      string    `gorm:"size:50" json:"label"`
+	Recipient  string    `gorm:"size:100;not null" json:"recipient"`
+	Phone      string    `gorm:"size:30" json:"phone"`
+	Line1      string    `gorm:"size:200;not null" json:"line1"`
+	Line2      string    `gorm:"size:200" json:"line2"`
+	City       string    `gorm:"size:100;not null" json:"city"`
+	Region     string    `gorm:"size:100" json:"region"`
+	PostalCode string    `gorm:"size:20" json:"postal_code"`
+	Country    string    `gorm:"type:char(2);not null" json:"country"` // ISO 3166-1 alpha-2
+
+	IsDefaultShipping bool `gorm:"not null;default:false" json:"is_default_shipping"`
+	IsDefaultBilling  bool `gorm:"not null;default:false" json:"is_default_billing"`
+
+	CreatedAt time.Time      `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt time.Time      `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-" swaggerignore:"true"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// AddressSnapshot is a copy of an address stored on the order, so editing or deleting
+// the address book entry later doesn't change where an order went.
+// Columns are nullable because orders placed before addresses existed have none.
+type AddressSnapshot struct {
+	Recipient  string `gorm:"size:100" json:"recipient"`
+	Phone      string `gorm:"size:30" json:"phone"`
+	Line1      string `gorm:"size:200" json:"line1"`
+	Line2      string `gorm:"size:200" json:"line2"`
+	City       string `gorm:"size:100" json:"city"`
+	Region     string `gorm:"size:100" json:"region"`
+	PostalCode string `gorm:"size:20" json:"postal_code"`
+	Country    string `gorm:"type:char(2)" json:"country"`
+}
+
+// Snapshot copies the address onto an order. A nil address gives an empty snapshot.
+func (a *UserAddress) Snapshot() AddressSnapshot {
+	if a == nil {
+		return AddressSnapshot{}
+	}
+	return AddressSnapshot{
+		Recipient:  a.Recipient,
+		Phone:      a.Phone,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		Region:     a.Region,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+	}
+}
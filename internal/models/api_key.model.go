@@ -0,0 +1,79 @@
+package models
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKey lets an integration call the API as its owner without logging in.
+// Scopes are permission names and narrow what the key can do; they never exceed the owner's permissions.
+// Only the SHA-256 hash of the key is stored, Prefix is kept to tell keys apart.
+type APIKey struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Prefix     string     `gorm:"type:varchar(20);not null" json:"prefix"`
+	KeyHash    string     `gorm:"type:char(64);not null;uniqueIndex" json:"-"`
+	Scopes     string     `gorm:"type:text;not null" json:"-"`            // comma separated, see ScopeList
+	AllowedIPs string     `gorm:"type:text;not null;default:''" json:"-"` // comma separated IPs or CIDRs, empty allows any
+	MFA        bool       `gorm:"not null;default:false" json:"mfa"`      // created from a 2FA session, may use TwoFactorPermissions
+	ExpiresAt  *time.Time `gorm:"type:timestamptz" json:"expires_at"`
+	LastUsedAt *time.Time `gorm:"type:timestamptz" json:"last_used_at"`
+	LastUsedIP string     `gorm:"type:varchar(45)" json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `gorm:"type:timestamptz" json:"revoked_at"`
+	CreatedAt  time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (k *APIKey) ScopeList() []string {
+	return splitList(k.Scopes)
+}
+
+func (k *APIKey) AllowedIPList() []string {
+	return splitList(k.AllowedIPs)
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsIP checks the client address against the allowlist
+func (k *APIKey) AllowsIP(ip string) bool {
+	allowed := k.AllowedIPList()
+	if len(allowed) == 0 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range allowed {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if other := net.ParseIP(entry); other != nil && other.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(raw string) []string {
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AuditLoginLockout         = "auth.lockout"
+	AuditLoginUnlock          = "auth.unlock"
+	AuditUserErase            = "user.erase"
+	AuditUserSuspend          = "user.suspend"
+	AuditUserReactivate       = "user.reactivate"
+	AuditPasswordResetForced  = "user.password_reset_forced"
+	AuditImpersonationStart   = "impersonation.start"
+	AuditImpersonationRequest = "impersonation.request"
+	AuditRoleAssign           = "role.assign"
+	AuditRoleRevoke           = "role.revoke"
+	AuditProductCreate        = "product.create"
+	AuditProductUpdate        = "product.update"
+	AuditProductDelete        = "product.delete"
+	AuditCartDelete           = "cart.delete"
+	AuditOrderStatusChange    = "order.status_change"
+	AuditRefundCreate         = "refund.create"
+	AuditRefundProcess        = "refund.process"
+	AuditReturnStatusChange   = "return.status_change"
+	AuditWebhookReprocess     = "payment.webhook_reprocess"
+)
+
+// Target types of audit entries
+const (
+	AuditTargetUser         = "user"
+	AuditTargetProduct      = "product"
+	AuditTargetCart         = "cart"
+	AuditTargetOrder        = "order"
+	AuditTargetRefund       = "refund"
+	AuditTargetReturn       = "return"
+	AuditTargetWebhookEvent = "payment_webhook_event"
+)
+
+// AuditLog records security relevant events and privileged changes. ActorID is nil when the system acted.
+// Rows are never updated or deleted, the database rejects it, see repository.EnsureAuditLogAppendOnly.
+type AuditLog struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ActorID    *uuid.UUID `gorm:"type:uuid;index" json:"actor_id"`
+	Action     string     `gorm:"type:varchar(100);not null;index" json:"action"`
+	TargetType string     `gorm:"type:varchar(50);not null" json:"target_type"`
+	TargetID   string     `gorm:"type:varchar(100);index" json:"target_id"`
+	IP         string     `gorm:"type:varchar(45)" json:"ip"`
+	RequestID  string     `gorm:"type:varchar(64);index" json:"request_id,omitempty"`
+	Changes    *string    `gorm:"type:jsonb" json:"changes,omitempty"` // {"field": {"from": ..., "to": ...}}
+	Metadata   *string    `gorm:"type:jsonb" json:"metadata,omitempty"`
+	CreatedAt  time.Time  `gorm:"type:timestamptz;not null;default:now();index" json:"created_at"`
+}
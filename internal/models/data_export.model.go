@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DataExportStatus string
+
+const (
+	ExportPending    DataExportStatus = "pending"
+	ExportProcessing DataExportStatus = "processing"
+	ExportReady      DataExportStatus = "ready"
+	ExportFailed     DataExportStatus = "failed"
+)
+
+type DataExportFormat string
+
+const (
+	ExportJSON DataExportFormat = "json"
+	ExportCSV  DataExportFormat = "csv"
+)
+
+// DataExport is a user's request for a copy of their data. The archive is built in the
+// background and kept outside the public upload dir until ExpiresAt.
+type DataExport struct {
+	ID          uuid.UUID        `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID      uuid.UUID        `gorm:"type:uuid;not null;index" json:"user_id"`
+	Format      DataExportFormat `gorm:"type:varchar(10);not null" json:"format"`
+	Status      DataExportStatus `gorm:"type:varchar(20);not null;default:'pending'" json:"status"`
+	FilePath    string           `gorm:"type:text" json:"-"`
+	Error       string           `gorm:"type:text" json:"error,omitempty"`
+	CompletedAt *time.Time       `gorm:"type:timestamptz" json:"completed_at"`
+	ExpiresAt   *time.Time       `gorm:"type:timestamptz" json:"expires_at"`
+	CreatedAt   time.Time        `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
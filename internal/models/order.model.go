@@ -11,12 +11,41 @@ import (
 type OrderStatus string
 
 const (
-	OrderPending   OrderStatus = "pending"
-	OrderPaid      OrderStatus = "paid"
-	OrderShipped   OrderStatus = "shipped"
-	OrderCancelled OrderStatus = "cancelled"
+	OrderPending    OrderStatus = "pending"
+	OrderPaid       OrderStatus = "paid"
+	OrderProcessing OrderStatus = "processing"
+	OrderShipped    OrderStatus = "shipped"
+	OrderDelivered  OrderStatus = "delivered"
+	OrderCancelled  OrderStatus = "cancelled"
+	OrderRefunded   OrderStatus = "refunded"
 )
 
+// orderTransitions lists the statuses an order may move to from each status.
+// cancelled and refunded are terminal.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderPending:    {OrderPaid, OrderCancelled},
+	OrderPaid:       {OrderProcessing, OrderCancelled, OrderRefunded},
+	OrderProcessing: {OrderShipped, OrderCancelled, OrderRefunded},
+	OrderShipped:    {OrderDelivered},
+	OrderDelivered:  {OrderRefunded},
+	OrderCancelled:  {},
+	OrderRefunded:   {},
+}
+
+func (s OrderStatus) IsValid() bool {
+	_, ok := orderTransitions[s]
+	return ok
+}
+
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
 type Order struct {
 	ID             uuid.UUID       `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
 	UserID         uuid.UUID       `gorm:"type:uuid;not null;index" json:"user_id"`
@@ -27,10 +56,16 @@ type Order struct {
 	TaxAmount      decimal.Decimal `gorm:"type:numeric(10,2);default:0" json:"tax_amount"`
 	ShippingAmount decimal.Decimal `gorm:"type:numeric(10,2);default:0" json:"shipping_amount"`
 	TotalAmount    decimal.Decimal `gorm:"type:numeric(10,2);not null" json:"total_amount"`
+	RefundedAmount decimal.Decimal `gorm:"type:numeric(10,2);not null;default:0" json:"refunded_amount"`
 	CreatedAt      time.Time       `gorm:"not null;default:now()" json:"created_at"`
 	UpdatedAt      time.Time       `gorm:"not null;default:now()" json:"updated_at"`
 	DeletedAt      gorm.DeletedAt  `gorm:"index" json:"deleted_at" swaggerignore:"true"`
 
-	OrderItems []OrderItem `gorm:"foreignKey:OrderID;references:ID;constraint:OnDelete:CASCADE" json:"order_items"`
-	User       User        `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE" json:"user"`
+	// copied from the address book at checkout
+	ShippingAddress AddressSnapshot `gorm:"embedded;embeddedPrefix:shipping_" json:"shipping_address"`
+	BillingAddress  AddressSnapshot `gorm:"embedded;embeddedPrefix:billing_" json:"billing_address"`
+
+	OrderItems    []OrderItem          `gorm:"foreignKey:OrderID;references:ID;constraint:OnDelete:CASCADE" json:"order_items"`
+	StatusHistory []OrderStatusHistory `gorm:"foreignKey:OrderID;references:ID;constraint:OnDelete:CASCADE" json:"status_history,omitempty"`
+	User          User                 `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE" json:"user"`
 }
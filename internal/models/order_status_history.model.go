@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SystemActorID is recorded as the actor for changes nobody triggered directly,
+// e.g. an order becoming paid after the payment provider captured it
+var SystemActorID = uuid.Nil
+
+// OrderStatusHistory records every status change of an order
+type OrderStatusHistory struct {
+	ID         uuid.UUID    `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	OrderID    uuid.UUID    `gorm:"type:uuid;not null;index" json:"order_id"`
+	FromStatus *OrderStatus `gorm:"type:order_status" json:"from_status"` // nil when the order is created
+	ToStatus   OrderStatus  `gorm:"type:order_status;not null" json:"to_status"`
+	ChangedBy  uuid.UUID    `gorm:"type:uuid;not null;index" json:"changed_by"`
+	Reason     string       `gorm:"type:text" json:"reason"`
+	CreatedAt  time.Time    `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+}
+
+func (OrderStatusHistory) TableName() string {
+	return "order_status_history"
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type PaymentStatus string
+
+const (
+	PaymentPending    PaymentStatus = "pending"    // waiting for the customer to confirm
+	PaymentAuthorized PaymentStatus = "authorized" // confirmed, not captured yet
+	PaymentCaptured   PaymentStatus = "captured"
+	PaymentFailed     PaymentStatus = "failed"
+	PaymentVoided     PaymentStatus = "voided"
+)
+
+type Payment struct {
+	ID             uuid.UUID       `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	OrderID        uuid.UUID       `gorm:"type:uuid;not null;index;uniqueIndex:uq_payment_open_order,where:status = 'pending' OR status = 'authorized'" json:"order_id"` // at most one open payment per order
+	Provider       string          `gorm:"type:varchar(30);not null;uniqueIndex:uq_payment_provider_ref" json:"provider"`
+	ProviderRef    string          `gorm:"type:varchar(100);not null;uniqueIndex:uq_payment_provider_ref" json:"provider_ref"`
+	ClientSecret   string          `gorm:"type:varchar(255)" json:"client_secret,omitempty"`
+	Status         PaymentStatus   `gorm:"type:varchar(20);not null;default:'pending'" json:"status"`
+	Amount         decimal.Decimal `gorm:"type:numeric(10,2);not null" json:"amount"`
+	CapturedAmount decimal.Decimal `gorm:"type:numeric(10,2);not null;default:0" json:"captured_amount"`
+	Currency       string          `gorm:"type:char(3);not null;default:'INR'" json:"currency"`
+	FailureReason  string          `gorm:"type:text" json:"failure_reason,omitempty"`
+	CapturedAt     *time.Time      `json:"captured_at"`
+	LastEventAt    *time.Time      `json:"-"` // occurred_at of the newest webhook event applied
+	CreatedAt      time.Time       `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt      time.Time       `gorm:"not null;default:now()" json:"updated_at"`
+
+	Order Order `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// IsFinal reports whether the payment can't change anymore (except for refunds)
+func (p *Payment) IsFinal() bool {
+	return p.Status == PaymentCaptured || p.Status == PaymentFailed || p.Status == PaymentVoided
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WebhookEventStatus string
+
+const (
+	WebhookReceived   WebhookEventStatus = "received"
+	WebhookProcessed  WebhookEventStatus = "processed"
+	WebhookUnknown    WebhookEventStatus = "unknown"      // event type we don't handle
+	WebhookUnmatched  WebhookEventStatus = "unmatched"    // no payment with that provider reference
+	WebhookOutOfOrder WebhookEventStatus = "out_of_order" // older than the last event applied to the payment
+	WebhookFailed     WebhookEventStatus = "failed"
+)
+
+// PaymentWebhookEvent keeps every inbound provider event, deduplicated by provider event id
+type PaymentWebhookEvent struct {
+	ID          uuid.UUID          `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Provider    string             `gorm:"type:varchar(30);not null;uniqueIndex:uq_webhook_provider_event" json:"provider"`
+	EventID     string             `gorm:"type:varchar(100);not null;uniqueIndex:uq_webhook_provider_event" json:"event_id"`
+	EventType   string             `gorm:"type:varchar(100);not null" json:"event_type"`
+	Reference   string             `gorm:"type:varchar(100);index" json:"reference"`
+	PaymentID   *uuid.UUID         `gorm:"type:uuid;index" json:"payment_id"`
+	Payload     string             `gorm:"type:text;not null" json:"payload"`
+	Status      WebhookEventStatus `gorm:"type:varchar(20);not null;default:'received';index" json:"status"`
+	Error       string             `gorm:"type:text" json:"error,omitempty"`
+	Attempts    int                `gorm:"not null;default:0" json:"attempts"`
+	OccurredAt  time.Time          `gorm:"type:timestamptz;not null" json:"occurred_at"`
+	ReceivedAt  time.Time          `gorm:"type:timestamptz;not null;default:now()" json:"received_at"`
+	ProcessedAt *time.Time         `gorm:"type:timestamptz" json:"processed_at"`
+}
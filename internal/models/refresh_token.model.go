@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshToken is an opaque, single-use token. Only its SHA-256 hash is stored.
+// Every rotation stays in the same family so a reused token can revoke the whole chain.
+type RefreshToken struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index"`
+	FamilyID   uuid.UUID  `gorm:"type:uuid;not null;index"`
+	TokenHash  string     `gorm:"type:char(64);not null;uniqueIndex"`
+	ExpiresAt  time.Time  `gorm:"type:timestamptz;not null"`
+	UsedAt     *time.Time `gorm:"type:timestamptz"` // set when rotated
+	RevokedAt  *time.Time `gorm:"type:timestamptz"`
+	ReplacedBy *uuid.UUID `gorm:"type:uuid"`
+	MFA        bool       `gorm:"not null;default:false"` // carried over to every access token of the session
+	UserAgent  string     `gorm:"type:text"`
+	IP         string     `gorm:"type:varchar(45)"`
+	CreatedAt  time.Time  `gorm:"type:timestamptz;not null;default:now()"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type RefundStatus string
+
+const (
+	RefundRequested  RefundStatus = "requested"
+	RefundProcessing RefundStatus = "processing" // sent to the payment provider
+	RefundSucceeded  RefundStatus = "succeeded"
+	RefundFailed     RefundStatus = "failed"
+)
+
+type Refund struct {
+	ID            uuid.UUID       `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	OrderID       uuid.UUID       `gorm:"type:uuid;not null;index" json:"order_id"`
+	PaymentID     *uuid.UUID      `gorm:"type:uuid;index" json:"payment_id"`
+	Amount        decimal.Decimal `gorm:"type:numeric(10,2);not null;check:amount > 0" json:"amount"`
+	Status        RefundStatus    `gorm:"type:varchar(20);not null;default:'requested'" json:"status"`
+	Reason        string          `gorm:"type:text" json:"reason"`
+	Restock       bool            `gorm:"type:boolean;not null;default:false" json:"restock"`
+	ProviderRef   string          `gorm:"type:varchar(100)" json:"provider_ref,omitempty"`
+	FailureReason string          `gorm:"type:text" json:"failure_reason,omitempty"`
+	RequestedBy   uuid.UUID       `gorm:"type:uuid;not null" json:"requested_by"`
+	ProcessedBy   *uuid.UUID      `gorm:"type:uuid" json:"processed_by"`
+	ProcessedAt   *time.Time      `json:"processed_at"`
+	CreatedAt     time.Time       `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt     time.Time       `gorm:"not null;default:now()" json:"updated_at"`
+
+	Items []RefundItem `gorm:"foreignKey:RefundID;constraint:OnDelete:CASCADE" json:"items,omitempty"`
+	Order Order        `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// RefundItem is the part of a refund that returns specific order items
+type RefundItem struct {
+	ID          uuid.UUID       `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	RefundID    uuid.UUID       `gorm:"type:uuid;not null;index" json:"refund_id"`
+	OrderItemID uuid.UUID       `gorm:"type:uuid;not null;index" json:"order_item_id"`
+	Quantity    int             `gorm:"not null;check:quantity > 0" json:"quantity"`
+	Amount      decimal.Decimal `gorm:"type:numeric(10,2);not null" json:"amount"`
+
+	OrderItem OrderItem `gorm:"foreignKey:OrderItemID;constraint:OnDelete:CASCADE" json:"-"`
+}
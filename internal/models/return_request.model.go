@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ReturnStatus string
+
+const (
+	ReturnRequested ReturnStatus = "requested"
+	ReturnApproved  ReturnStatus = "approved" // customer may ship the items back
+	ReturnRejected  ReturnStatus = "rejected"
+	ReturnReceived  ReturnStatus = "received"
+	ReturnCompleted ReturnStatus = "completed" // passed inspection, refunded and restocked
+	ReturnDeclined  ReturnStatus = "declined"  // failed inspection
+)
+
+var returnTransitions = map[ReturnStatus][]ReturnStatus{
+	ReturnRequested: {ReturnApproved, ReturnRejected},
+	ReturnApproved:  {ReturnReceived},
+	ReturnReceived:  {ReturnCompleted, ReturnDeclined},
+	ReturnRejected:  {},
+	ReturnCompleted: {},
+	ReturnDeclined:  {},
+}
+
+func (s ReturnStatus) IsValid() bool {
+	_, ok := returnTransitions[s]
+	return ok
+}
+
+func (s ReturnStatus) CanTransitionTo(next ReturnStatus) bool {
+	for _, allowed := range returnTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// ReturnRequest is a return merchandise authorization (RMA) for items of a delivered order
+type ReturnRequest struct {
+	ID        uuid.UUID    `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	OrderID   uuid.UUID    `gorm:"type:uuid;not null;index" json:"order_id"`
+	UserID    uuid.UUID    `gorm:"type:uuid;not null;index" json:"user_id"`
+	Status    ReturnStatus `gorm:"type:varchar(20);not null;default:'requested';index" json:"status"`
+	Reason    string       `gorm:"type:text;not null" json:"reason"`
+	RefundID  *uuid.UUID   `gorm:"type:uuid" json:"refund_id"`
+	CreatedAt time.Time    `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt time.Time    `gorm:"not null;default:now()" json:"updated_at"`
+
+	Items  []ReturnItem  `gorm:"foreignKey:ReturnRequestID;constraint:OnDelete:CASCADE" json:"items"`
+	Events []ReturnEvent `gorm:"foreignKey:ReturnRequestID;constraint:OnDelete:CASCADE" json:"events,omitempty"`
+	Order  Order         `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+type ReturnItem struct {
+	ID              uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ReturnRequestID uuid.UUID `gorm:"type:uuid;not null;index" json:"return_request_id"`
+	OrderItemID     uuid.UUID `gorm:"type:uuid;not null;index" json:"order_item_id"`
+	Quantity        int       `gorm:"not null;check:quantity > 0" json:"quantity"`
+	Reason          string    `gorm:"type:text" json:"reason"`
+
+	OrderItem OrderItem `gorm:"foreignKey:OrderItemID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// ReturnEvent records every step of a return
+type ReturnEvent struct {
+	ID              uuid.UUID     `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ReturnRequestID uuid.UUID     `gorm:"type:uuid;not null;index" json:"return_request_id"`
+	FromStatus      *ReturnStatus `gorm:"type:varchar(20)" json:"from_status"`
+	ToStatus        ReturnStatus  `gorm:"type:varchar(20);not null" json:"to_status"`
+	ActorID         uuid.UUID     `gorm:"type:uuid;not null" json:"actor_id"`
+	Note            string        `gorm:"type:text" json:"note"`
+	CreatedAt       time.Time     `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	RoleAdmin    = "admin"
+	RoleSeller   = "seller"
+	RoleCustomer = "customer"
+)
+
+const (
+	PermProductWrite    = "product:write"
+	PermProductManage   = "product:manage" // change products created by anyone
+	PermOrderManage     = "order:manage"
+	PermOrderRefund     = "order:refund"
+	PermReturnManage    = "return:manage"
+	PermPaymentManage   = "payment:manage"
+	PermCartAdmin       = "cart:admin"
+	PermUserManage      = "user:manage"
+	PermRoleManage      = "role:manage"
+	PermUserImpersonate = "user:impersonate"
+	PermAuditRead       = "audit:read"
+)
+
+// DefaultRolePermissions is seeded at startup, see repository.SeedRolesAndPermissions
+var DefaultRolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermProductWrite, PermProductManage, PermOrderManage, PermOrderRefund, PermReturnManage,
+		PermPaymentManage, PermCartAdmin, PermUserManage, PermRoleManage,
+		PermUserImpersonate, PermAuditRead,
+	},
+	RoleSeller:   {PermProductWrite},
+	RoleCustomer: {},
+}
+
+// TwoFactorPermissions only work from a session that passed two-factor authentication
+var TwoFactorPermissions = map[string]bool{
+	PermProductWrite:    true,
+	PermOrderRefund:     true,
+	PermUserImpersonate: true,
+}
+
+type Role struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name        string    `gorm:"size:50;unique;not null" json:"name"`
+	Description string    `gorm:"type:text" json:"description"`
+	CreatedAt   time.Time `gorm:"not null;default:now()" json:"created_at"`
+
+	Permissions []Permission `gorm:"many2many:role_permissions;constraint:OnDelete:CASCADE" json:"permissions"`
+}
+
+type Permission struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name      string    `gorm:"size:100;unique;not null" json:"name"`
+	CreatedAt time.Time `gorm:"not null;default:now()" json:"created_at"`
+}
+
+type UserRole struct {
+	UserID     uuid.UUID  `gorm:"type:uuid;primaryKey" json:"user_id"`
+	RoleID     uuid.UUID  `gorm:"type:uuid;primaryKey;index" json:"role_id"`
+	AssignedBy *uuid.UUID `gorm:"type:uuid" json:"assigned_by"` // nil for registration and bootstrap
+	CreatedAt  time.Time  `gorm:"not null;default:now()" json:"created_at"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Role Role `gorm:"foreignKey:RoleID;constraint:OnDelete:CASCADE" json:"role"`
+}
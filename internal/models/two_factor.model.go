@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserTOTP holds a user's authenticator secret, encrypted with MFA_SECRET_KEY.
+// 2FA is enabled once ConfirmedAt is set.
+type UserTOTP struct {
+	UserID          uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	SecretEncrypted string     `gorm:"type:text;not null" json:"-"`
+	ConfirmedAt     *time.Time `gorm:"type:timestamptz"`
+	LastUsedStep    int64      `gorm:"not null;default:0" json:"-"` // stops a code from being used twice
+	CreatedAt       time.Time  `gorm:"type:timestamptz;not null;default:now()"`
+	UpdatedAt       time.Time  `gorm:"type:timestamptz;not null;default:now()"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (UserTOTP) TableName() string {
+	return "user_totp"
+}
+
+func (t *UserTOTP) Enabled() bool {
+	return t.ConfirmedAt != nil
+}
+
+// RecoveryCode is a one-time backup code, stored as a SHA-256 hash
+type RecoveryCode struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index"`
+	CodeHash  string     `gorm:"type:char(64);not null;uniqueIndex"`
+	UsedAt    *time.Time `gorm:"type:timestamptz"`
+	CreatedAt time.Time  `gorm:"type:timestamptz;not null;default:now()"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
@@ -14,6 +14,16 @@ type User struct {
 	Email    string    `gorm:"size:100;unique;not null"`
 	Password string    `gorm:"size:255;not null" json:"-"`
 
+	EmailVerifiedAt *time.Time `gorm:"type:timestamptz" json:"email_verified_at"`
+	AvatarURL       string     `gorm:"size:500" json:"avatar_url"`
+	ErasedAt        *time.Time `gorm:"type:timestamptz" json:"erased_at,omitempty"` // personal data was anonymized, see repository.EraseUser
+
+	// a suspended account can't log in or use existing tokens and API keys
+	SuspendedAt     *time.Time `gorm:"type:timestamptz" json:"suspended_at,omitempty"`
+	SuspendedReason string     `gorm:"size:500" json:"suspended_reason,omitempty"`
+	// set by an admin, the password stops working until the user resets it
+	PasswordResetRequired bool `gorm:"not null;default:false" json:"password_reset_required"`
+
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at" swaggerignore:"true"`
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type UserTokenPurpose string
+
+const (
+	TokenPasswordReset     UserTokenPurpose = "password_reset"
+	TokenEmailVerification UserTokenPurpose = "email_verification"
+)
+
+// UserToken is a single-use, time-limited token mailed to a user.
+// Only its SHA-256 hash is stored.
+type UserToken struct {
+	ID        uuid.UUID        `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	UserID    uuid.UUID        `gorm:"type:uuid;not null;index"`
+	Purpose   UserTokenPurpose `gorm:"type:varchar(30);not null"`
+	TokenHash string           `gorm:"type:char(64);not null;uniqueIndex"`
+	Email     string           `gorm:"size:100"` // the address a verification token was sent to
+	ExpiresAt time.Time        `gorm:"type:timestamptz;not null"`
+	UsedAt    *time.Time       `gorm:"type:timestamptz"`
+	CreatedAt time.Time        `gorm:"type:timestamptz;not null;default:now()"`
+
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
@@ -0,0 +1,173 @@
+package payments
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+
+	"github.com/shopspring/decimal"
+)
+
+const MockProviderName = "mock"
+
+// MockProvider is an in-memory gateway for development and tests.
+// Intents are authorized as soon as they're created unless AutoConfirm is off,
+// in which case Confirm or Fail must be called to simulate the customer.
+type MockProvider struct {
+	AutoConfirm bool
+
+	mu      sync.Mutex
+	intents map[string]*Intent
+	refunds map[string]*RefundResult // by idempotency key
+}
+
+func NewMockProvider() *MockProvider {
+	return &MockProvider{
+		AutoConfirm: true,
+		intents:     map[string]*Intent{},
+		refunds:     map[string]*RefundResult{},
+	}
+}
+
+func (m *MockProvider) Name() string {
+	return MockProviderName
+}
+
+func (m *MockProvider) CreateIntent(ctx context.Context, amount decimal.Decimal, currency string, orderReference string) (*Intent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	intent := &Intent{
+		Reference:    "mock_pi_" + randomHex(12),
+		Status:       IntentRequiresConfirmation,
+		Amount:       amount,
+		Currency:     currency,
+		ClientSecret: "mock_secret_" + randomHex(16),
+	}
+	if m.AutoConfirm {
+		intent.Status = IntentAuthorized
+	}
+	m.intents[intent.Reference] = intent
+
+	copied := *intent
+	return &copied, nil
+}
+
+func (m *MockProvider) GetIntent(ctx context.Context, reference string) (*Intent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	intent, ok := m.intents[reference]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+	copied := *intent
+	return &copied, nil
+}
+
+// Confirm simulates the customer completing the payment
+func (m *MockProvider) Confirm(reference string) error {
+	return m.setStatus(reference, IntentRequiresConfirmation, IntentAuthorized, "")
+}
+
+// Fail simulates the customer's bank declining the payment
+func (m *MockProvider) Fail(reference string, reason string) error {
+	return m.setStatus(reference, IntentRequiresConfirmation, IntentFailed, reason)
+}
+
+func (m *MockProvider) Capture(ctx context.Context, reference string, amount decimal.Decimal) (*Intent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	intent, ok := m.intents[reference]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+	if intent.Status != IntentAuthorized {
+		return nil, ErrInvalidState
+	}
+	if amount.GreaterThan(intent.Amount) {
+		return nil, ErrAmountTooLarge
+	}
+
+	intent.Status = IntentCaptured
+	intent.CapturedAmount = amount
+	copied := *intent
+	return &copied, nil
+}
+
+func (m *MockProvider) Refund(ctx context.Context, reference string, amount decimal.Decimal, idempotencyKey string) (*RefundResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if result, ok := m.refunds[idempotencyKey]; ok {
+		copied := *result
+		return &copied, nil
+	}
+
+	intent, ok := m.intents[reference]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+	if intent.Status != IntentCaptured {
+		return nil, ErrInvalidState
+	}
+	if intent.RefundedAmount.Add(amount).GreaterThan(intent.CapturedAmount) {
+		return nil, ErrAmountTooLarge
+	}
+
+	intent.RefundedAmount = intent.RefundedAmount.Add(amount)
+	result := &RefundResult{
+		Reference: "mock_re_" + randomHex(12),
+		Amount:    amount,
+		Succeeded: true,
+	}
+	m.refunds[idempotencyKey] = result
+
+	copied := *result
+	return &copied, nil
+}
+
+func (m *MockProvider) Void(ctx context.Context, reference string) (*Intent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	intent, ok := m.intents[reference]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+	if intent.Status != IntentRequiresConfirmation && intent.Status != IntentAuthorized {
+		return nil, ErrInvalidState
+	}
+
+	intent.Status = IntentVoided
+	copied := *intent
+	return &copied, nil
+}
+
+func (m *MockProvider) setStatus(reference string, from IntentStatus, to IntentStatus, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	intent, ok := m.intents[reference]
+	if !ok {
+		return ErrIntentNotFound
+	}
+	if intent.Status != from {
+		return ErrInvalidState
+	}
+	intent.Status = to
+	intent.FailureReason = reason
+	return nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (m *MockProvider) ParseWebhook(body []byte) (*WebhookEvent, error) {
+	return parseGenericWebhook(body)
+}
@@ -0,0 +1,95 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/shopspring/decimal"
+)
+
+type IntentStatus string
+
+const (
+	IntentRequiresConfirmation IntentStatus = "requires_confirmation"
+	IntentAuthorized           IntentStatus = "authorized"
+	IntentCaptured             IntentStatus = "captured"
+	IntentVoided               IntentStatus = "voided"
+	IntentFailed               IntentStatus = "failed"
+)
+
+var (
+	ErrIntentNotFound = errors.New("payment intent not found")
+	ErrInvalidState   = errors.New("payment intent is not in a valid state for this operation")
+	ErrAmountTooLarge = errors.New("amount exceeds what is available")
+	ErrUnknownGateway = errors.New("unknown payment provider")
+)
+
+// Intent is the provider's view of a payment
+type Intent struct {
+	Reference      string
+	Status         IntentStatus
+	Amount         decimal.Decimal
+	CapturedAmount decimal.Decimal
+	RefundedAmount decimal.Decimal
+	Currency       string
+	ClientSecret   string // handed to the client to confirm the payment with the provider
+	FailureReason  string
+}
+
+// RefundResult is the provider's answer to a refund call
+type RefundResult struct {
+	Reference string
+	Amount    decimal.Decimal
+	Succeeded bool
+}
+
+// Provider is implemented by every payment gateway
+type Provider interface {
+	Name() string
+	CreateIntent(ctx context.Context, amount decimal.Decimal, currency string, orderReference string) (*Intent, error)
+	GetIntent(ctx context.Context, reference string) (*Intent, error)
+	Capture(ctx context.Context, reference string, amount decimal.Decimal) (*Intent, error)
+	// Refund must be idempotent per key: a retry with the same key returns the first result
+	// instead of refunding again, so a refund interrupted midway can be sent once more.
+	// ErrIntentNotFound, ErrInvalidState and ErrAmountTooLarge mean the refund was rejected,
+	// any other error leaves its outcome open.
+	Refund(ctx context.Context, reference string, amount decimal.Decimal, idempotencyKey string) (*RefundResult, error)
+	Void(ctx context.Context, reference string) (*Intent, error)
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]Provider{}
+)
+
+func Register(p Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[p.Name()] = p
+}
+
+func GetProvider(name string) (Provider, error) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownGateway, name)
+	}
+	return p, nil
+}
+
+// DefaultProvider returns the provider configured by PAYMENT_PROVIDER (mock when unset)
+func DefaultProvider() (Provider, error) {
+	name := config.LoadEnv().PaymentProvider
+	if name == "" {
+		name = MockProviderName
+	}
+	return GetProvider(name)
+}
+
+func init() {
+	Register(NewMockProvider())
+}
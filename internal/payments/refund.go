@@ -0,0 +1,102 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/helper"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+)
+
+var (
+	ErrRefundFailed  = errors.New("payment provider rejected the refund")
+	ErrRefundPending = errors.New("payment provider didn't confirm the refund, it will be retried")
+)
+
+// refundStaleAfter is how long a refund may wait for the provider before it counts as interrupted
+const refundStaleAfter = 10 * time.Minute
+
+// IssueRefund creates a refund and sends it to the payment provider right away
+func IssueRefund(ctx context.Context, params helper.RefundParams) (*models.Refund, error) {
+	refund, err := repository.CreateRefund(params)
+	if err != nil {
+		return nil, err
+	}
+	return ProcessRefund(ctx, refund.ID, params.ActorID)
+}
+
+// ProcessRefund sends a requested refund to the provider that captured the payment.
+// A refund the provider rejects is stored as failed and no longer counts against the captured amount.
+// When the outcome is unknown (timeout, network error) the refund stays processing and
+// ResumeRefunds sends it again; the refund id is the provider's idempotency key,
+// so the provider pays it out at most once.
+func ProcessRefund(ctx context.Context, refundID uuid.UUID, actorID uuid.UUID) (*models.Refund, error) {
+	refund, payment, err := repository.ClaimRefund(refundID, refundStaleAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := GetProvider(payment.Provider)
+	if err != nil {
+		return failRefund(refund.ID, actorID, err)
+	}
+
+	// a client hanging up mustn't cut the call short, the provider may already be paying out
+	result, err := provider.Refund(context.WithoutCancel(ctx), payment.ProviderRef, refund.Amount, refund.ID.String())
+	if err != nil {
+		if refundRejected(err) {
+			return failRefund(refund.ID, actorID, err)
+		}
+		log.Printf("refund %s left processing: %v", refund.ID, err)
+		return refund, errors.Join(ErrRefundPending, err)
+	}
+	if !result.Succeeded {
+		return failRefund(refund.ID, actorID, ErrRefundFailed)
+	}
+
+	return repository.CompleteRefund(refund.ID, actorID, true, result.Reference, "")
+}
+
+// refundRejected reports whether the provider definitely didn't refund
+func refundRejected(err error) bool {
+	return errors.Is(err, ErrIntentNotFound) ||
+		errors.Is(err, ErrInvalidState) ||
+		errors.Is(err, ErrAmountTooLarge)
+}
+
+func failRefund(refundID uuid.UUID, actorID uuid.UUID, cause error) (*models.Refund, error) {
+	refund, err := repository.CompleteRefund(refundID, actorID, false, "", cause.Error())
+	if err != nil {
+		return nil, err
+	}
+	return refund, errors.Join(ErrRefundFailed, cause)
+}
+
+// ResumeRefunds sends refunds interrupted by a crash or shutdown to the provider again,
+// now and then every refundStaleAfter. Called once at startup.
+func ResumeRefunds() {
+	go func() {
+		for {
+			resumeStaleRefunds()
+			time.Sleep(refundStaleAfter)
+		}
+	}()
+}
+
+func resumeStaleRefunds() {
+	ids, err := repository.StaleRefunds(refundStaleAfter)
+	if err != nil {
+		log.Println("Listing stale refunds failed:", err)
+		return
+	}
+	for _, id := range ids {
+		// another instance may have picked it up in the meantime
+		if _, err := ProcessRefund(context.Background(), id, models.SystemActorID); err != nil && !errors.Is(err, repository.ErrRefundNotPending) {
+			log.Printf("resuming refund %s failed: %v", id, err)
+		}
+	}
+}
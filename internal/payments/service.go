@@ -0,0 +1,119 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+)
+
+const defaultCurrency = "INR"
+
+var ErrOrderNotPayable = errors.New("order is not awaiting payment")
+
+// StartPayment creates a payment intent for a pending order.
+// If the order already has an open payment, that one is returned instead of a new one.
+func StartPayment(ctx context.Context, order *models.Order) (*models.Payment, error) {
+	if order.Status != models.OrderPending {
+		return nil, ErrOrderNotPayable
+	}
+
+	existing, err := repository.GetOpenPaymentForOrder(order.ID)
+	if err == nil {
+		return SyncPayment(ctx, existing)
+	}
+	if !utils.IsNotFound(err) {
+		return nil, err
+	}
+
+	provider, err := DefaultProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	intent, err := provider.CreateIntent(ctx, order.TotalAmount, defaultCurrency, order.OrderNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	payment := models.Payment{
+		OrderID:      order.ID,
+		Provider:     provider.Name(),
+		ProviderRef:  intent.Reference,
+		ClientSecret: intent.ClientSecret,
+		Status:       models.PaymentPending,
+		Amount:       order.TotalAmount,
+		Currency:     defaultCurrency,
+	}
+	created, err := repository.CreatePayment(&payment)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		// a parallel request got there first, drop this intent and continue with theirs
+		if _, err := provider.Void(ctx, intent.Reference); err != nil {
+			log.Printf("voiding duplicate intent %s failed: %v", intent.Reference, err)
+		}
+		existing, err := repository.GetOpenPaymentForOrder(order.ID)
+		if err != nil {
+			return nil, err
+		}
+		return SyncPayment(ctx, existing)
+	}
+
+	return SyncPayment(ctx, &payment)
+}
+
+// SyncPayment asks the provider for the current state of the payment and applies it.
+// Authorized payments are captured right away; the order only becomes paid once
+// the provider confirms the capture.
+func SyncPayment(ctx context.Context, payment *models.Payment) (*models.Payment, error) {
+	if payment.IsFinal() {
+		return payment, nil
+	}
+
+	provider, err := GetProvider(payment.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	intent, err := provider.GetIntent(ctx, payment.ProviderRef)
+	if err != nil {
+		return nil, err
+	}
+
+	if intent.Status == IntentAuthorized {
+		intent, err = provider.Capture(ctx, payment.ProviderRef, payment.Amount)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ApplyIntent(payment, intent); err != nil {
+		return nil, err
+	}
+
+	return repository.GetPaymentByID(payment.ID)
+}
+
+// ApplyIntent stores the provider's view of the payment
+func ApplyIntent(payment *models.Payment, intent *Intent) error {
+	switch intent.Status {
+	case IntentCaptured:
+		captured := intent.CapturedAmount
+		if !captured.IsPositive() {
+			captured = payment.Amount
+		}
+		return repository.MarkPaymentCaptured(payment.ID, captured)
+	case IntentAuthorized:
+		return repository.UpdatePaymentStatus(payment.ID, models.PaymentAuthorized, "")
+	case IntentFailed:
+		return repository.UpdatePaymentStatus(payment.ID, models.PaymentFailed, intent.FailureReason)
+	case IntentVoided:
+		return repository.UpdatePaymentStatus(payment.ID, models.PaymentVoided, "")
+	}
+	return nil
+}
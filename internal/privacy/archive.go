@@ -0,0 +1,407 @@
+package privacy
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+)
+
+// UserData is the content of an export. It has its own types instead of the models
+// so the archive layout doesn't change with internal columns.
+type UserData struct {
+	ExportedAt     time.Time       `json:"exported_at"`
+	Profile        Profile         `json:"profile"`
+	LinkedAccounts []LinkedAccount `json:"linked_accounts"`
+	Addresses      []Address       `json:"addresses"`
+	Cart           []CartItem      `json:"cart"`
+	Orders         []Order         `json:"orders"`
+	Payments       []Payment       `json:"payments"`
+	Refunds        []Refund        `json:"refunds"`
+	Returns        []Return        `json:"returns"`
+}
+
+type Profile struct {
+	ID              uuid.UUID  `json:"id"`
+	Fullname        string     `json:"fullname"`
+	Username        string     `json:"username"`
+	Email           string     `json:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	AvatarURL       string     `json:"avatar_url"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+type LinkedAccount struct {
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type Address struct {
+	Label             string                 `json:"label"`
+	Address           models.AddressSnapshot `json:"address"`
+	IsDefaultShipping bool                   `json:"is_default_shipping"`
+	IsDefaultBilling  bool                   `json:"is_default_billing"`
+	CreatedAt         time.Time              `json:"created_at"`
+}
+
+type CartItem struct {
+	ProductID   uuid.UUID `json:"product_id"`
+	ProductName string    `json:"product_name"`
+	Quantity    int       `json:"quantity"`
+	AddedAt     time.Time `json:"added_at"`
+}
+
+type Order struct {
+	OrderNumber     string                 `json:"order_number"`
+	Status          models.OrderStatus     `json:"status"`
+	Subtotal        string                 `json:"subtotal"`
+	DiscountAmount  string                 `json:"discount_amount"`
+	TaxAmount       string                 `json:"tax_amount"`
+	ShippingAmount  string                 `json:"shipping_amount"`
+	TotalAmount     string                 `json:"total_amount"`
+	RefundedAmount  string                 `json:"refunded_amount"`
+	ShippingAddress models.AddressSnapshot `json:"shipping_address"`
+	BillingAddress  models.AddressSnapshot `json:"billing_address"`
+	Items           []OrderItem            `json:"items"`
+	StatusHistory   []OrderStatusChange    `json:"status_history"`
+	CreatedAt       time.Time              `json:"created_at"`
+}
+
+type OrderItem struct {
+	ProductName     string `json:"product_name"`
+	ProductPrice    string `json:"product_price"`
+	DiscountPercent string `json:"discount_percent"`
+	Quantity        int    `json:"quantity"`
+	TotalPrice      string `json:"total_price"`
+}
+
+type OrderStatusChange struct {
+	Status    models.OrderStatus `json:"status"`
+	Reason    string             `json:"reason"`
+	ChangedAt time.Time          `json:"changed_at"`
+}
+
+type Payment struct {
+	OrderNumber    string               `json:"order_number"`
+	Provider       string               `json:"provider"`
+	Status         models.PaymentStatus `json:"status"`
+	Amount         string               `json:"amount"`
+	CapturedAmount string               `json:"captured_amount"`
+	Currency       string               `json:"currency"`
+	CreatedAt      time.Time            `json:"created_at"`
+}
+
+type Refund struct {
+	OrderNumber string              `json:"order_number"`
+	Amount      string              `json:"amount"`
+	Status      models.RefundStatus `json:"status"`
+	Reason      string              `json:"reason"`
+	CreatedAt   time.Time           `json:"created_at"`
+}
+
+type Return struct {
+	OrderNumber string              `json:"order_number"`
+	Status      models.ReturnStatus `json:"status"`
+	Reason      string              `json:"reason"`
+	Items       int                 `json:"items"`
+	CreatedAt   time.Time           `json:"created_at"`
+}
+
+func collect(userID uuid.UUID) (*UserData, error) {
+	user, err := repository.GetUserByUUID(userID)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := repository.GetUserIdentities(userID)
+	if err != nil {
+		return nil, err
+	}
+	addresses, err := repository.ListAddresses(userID)
+	if err != nil {
+		return nil, err
+	}
+	cartItems, err := repository.GetUserCartItems(userID)
+	if err != nil {
+		return nil, err
+	}
+	orderData, err := repository.GetUserOrderData(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data := UserData{
+		ExportedAt: time.Now().UTC(),
+		Profile: Profile{
+			ID:              user.ID,
+			Fullname:        user.Fullname,
+			Username:        user.Username,
+			Email:           user.Email,
+			EmailVerifiedAt: user.EmailVerifiedAt,
+			AvatarURL:       user.AvatarURL,
+			CreatedAt:       user.CreatedAt,
+		},
+		LinkedAccounts: []LinkedAccount{},
+		Addresses:      []Address{},
+		Cart:           []CartItem{},
+		Orders:         []Order{},
+		Payments:       []Payment{},
+		Refunds:        []Refund{},
+		Returns:        []Return{},
+	}
+
+	for _, identity := range identities {
+		data.LinkedAccounts = append(data.LinkedAccounts, LinkedAccount{
+			Provider:    identity.Provider,
+			Email:       identity.Email,
+			LastLoginAt: identity.LastLoginAt,
+			CreatedAt:   identity.CreatedAt,
+		})
+	}
+	for _, address := range addresses {
+		data.Addresses = append(data.Addresses, Address{
+			Label:             address.Label,
+			Address:           address.Snapshot(),
+			IsDefaultShipping: address.IsDefaultShipping,
+			IsDefaultBilling:  address.IsDefaultBilling,
+			CreatedAt:         address.CreatedAt,
+		})
+	}
+	for _, item := range cartItems {
+		data.Cart = append(data.Cart, CartItem{
+			ProductID:   item.ProductID,
+			ProductName: item.Product.Name,
+			Quantity:    item.Quantity,
+			AddedAt:     item.AddedAt,
+		})
+	}
+
+	orderNumbers := make(map[uuid.UUID]string, len(orderData.Orders))
+	for _, o := range orderData.Orders {
+		orderNumbers[o.ID] = o.OrderNumber
+		order := Order{
+			OrderNumber:     o.OrderNumber,
+			Status:          o.Status,
+			Subtotal:        o.Subtotal.StringFixed(2),
+			DiscountAmount:  o.DiscountAmount.StringFixed(2),
+			TaxAmount:       o.TaxAmount.StringFixed(2),
+			ShippingAmount:  o.ShippingAmount.StringFixed(2),
+			TotalAmount:     o.TotalAmount.StringFixed(2),
+			RefundedAmount:  o.RefundedAmount.StringFixed(2),
+			ShippingAddress: o.ShippingAddress,
+			BillingAddress:  o.BillingAddress,
+			Items:           []OrderItem{},
+			StatusHistory:   []OrderStatusChange{},
+			CreatedAt:       o.CreatedAt,
+		}
+		for _, item := range o.OrderItems {
+			order.Items = append(order.Items, OrderItem{
+				ProductName:     item.ProductName,
+				ProductPrice:    item.ProductPrice.StringFixed(2),
+				DiscountPercent: item.DiscountPercent.String(),
+				Quantity:        item.Quantity,
+				TotalPrice:      item.TotalPrice.StringFixed(2),
+			})
+		}
+		for _, change := range o.StatusHistory {
+			order.StatusHistory = append(order.StatusHistory, OrderStatusChange{
+				Status:    change.ToStatus,
+				Reason:    change.Reason,
+				ChangedAt: change.CreatedAt,
+			})
+		}
+		data.Orders = append(data.Orders, order)
+	}
+	for _, p := range orderData.Payments {
+		data.Payments = append(data.Payments, Payment{
+			OrderNumber:    orderNumbers[p.OrderID],
+			Provider:       p.Provider,
+			Status:         p.Status,
+			Amount:         p.Amount.StringFixed(2),
+			CapturedAmount: p.CapturedAmount.StringFixed(2),
+			Currency:       p.Currency,
+			CreatedAt:      p.CreatedAt,
+		})
+	}
+	for _, r := range orderData.Refunds {
+		data.Refunds = append(data.Refunds, Refund{
+			OrderNumber: orderNumbers[r.OrderID],
+			Amount:      r.Amount.StringFixed(2),
+			Status:      r.Status,
+			Reason:      r.Reason,
+			CreatedAt:   r.CreatedAt,
+		})
+	}
+	for _, r := range orderData.Returns {
+		data.Returns = append(data.Returns, Return{
+			OrderNumber: orderNumbers[r.OrderID],
+			Status:      r.Status,
+			Reason:      r.Reason,
+			Items:       len(r.Items),
+			CreatedAt:   r.CreatedAt,
+		})
+	}
+
+	return &data, nil
+}
+
+func writeJSONFile(zw *zip.Writer, data *UserData) error {
+	w, err := zw.Create("data.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+// writeCSVFiles writes one file per section. Nested order data is flattened into
+// order_items.csv and order_status_history.csv, keyed by order number.
+func writeCSVFiles(zw *zip.Writer, data *UserData) error {
+	p := data.Profile
+	files := []struct {
+		name string
+		rows [][]string
+	}{
+		{"profile.csv", [][]string{
+			{"id", "fullname", "username", "email", "email_verified_at", "avatar_url", "created_at"},
+			{p.ID.String(), p.Fullname, p.Username, p.Email, formatTimePtr(p.EmailVerifiedAt), p.AvatarURL, formatTime(p.CreatedAt)},
+		}},
+		{"linked_accounts.csv", linkedAccountRows(data.LinkedAccounts)},
+		{"addresses.csv", addressRows(data.Addresses)},
+		{"cart.csv", cartRows(data.Cart)},
+		{"orders.csv", orderRows(data.Orders)},
+		{"order_items.csv", orderItemRows(data.Orders)},
+		{"order_status_history.csv", orderStatusRows(data.Orders)},
+		{"payments.csv", paymentRows(data.Payments)},
+		{"refunds.csv", refundRows(data.Refunds)},
+		{"returns.csv", returnRows(data.Returns)},
+	}
+
+	for _, file := range files {
+		w, err := zw.Create(file.name)
+		if err != nil {
+			return err
+		}
+		cw := csv.NewWriter(w)
+		if err := cw.WriteAll(file.rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var addressColumns = []string{"recipient", "phone", "line1", "line2", "city", "region", "postal_code", "country"}
+
+func addressFields(a models.AddressSnapshot) []string {
+	return []string{a.Recipient, a.Phone, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country}
+}
+
+func prefixed(prefix string, columns []string) []string {
+	out := make([]string, 0, len(columns))
+	for _, c := range columns {
+		out = append(out, prefix+c)
+	}
+	return out
+}
+
+func linkedAccountRows(accounts []LinkedAccount) [][]string {
+	rows := [][]string{{"provider", "email", "last_login_at", "created_at"}}
+	for _, a := range accounts {
+		rows = append(rows, []string{a.Provider, a.Email, formatTimePtr(a.LastLoginAt), formatTime(a.CreatedAt)})
+	}
+	return rows
+}
+
+func addressRows(addresses []Address) [][]string {
+	header := append([]string{"label"}, addressColumns...)
+	rows := [][]string{append(header, "is_default_shipping", "is_default_billing", "created_at")}
+	for _, a := range addresses {
+		row := append([]string{a.Label}, addressFields(a.Address)...)
+		rows = append(rows, append(row, strconv.FormatBool(a.IsDefaultShipping), strconv.FormatBool(a.IsDefaultBilling), formatTime(a.CreatedAt)))
+	}
+	return rows
+}
+
+func cartRows(items []CartItem) [][]string {
+	rows := [][]string{{"product_id", "product_name", "quantity", "added_at"}}
+	for _, item := range items {
+		rows = append(rows, []string{item.ProductID.String(), item.ProductName, strconv.Itoa(item.Quantity), formatTime(item.AddedAt)})
+	}
+	return rows
+}
+
+func orderRows(orders []Order) [][]string {
+	header := []string{"order_number", "status", "subtotal", "discount_amount", "tax_amount", "shipping_amount", "total_amount", "refunded_amount", "created_at"}
+	header = append(header, prefixed("shipping_", addressColumns)...)
+	header = append(header, prefixed("billing_", addressColumns)...)
+	rows := [][]string{header}
+	for _, o := range orders {
+		row := []string{o.OrderNumber, string(o.Status), o.Subtotal, o.DiscountAmount, o.TaxAmount, o.ShippingAmount, o.TotalAmount, o.RefundedAmount, formatTime(o.CreatedAt)}
+		row = append(row, addressFields(o.ShippingAddress)...)
+		row = append(row, addressFields(o.BillingAddress)...)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func orderItemRows(orders []Order) [][]string {
+	rows := [][]string{{"order_number", "product_name", "product_price", "discount_percent", "quantity", "total_price"}}
+	for _, o := range orders {
+		for _, item := range o.Items {
+			rows = append(rows, []string{o.OrderNumber, item.ProductName, item.ProductPrice, item.DiscountPercent, strconv.Itoa(item.Quantity), item.TotalPrice})
+		}
+	}
+	return rows
+}
+
+func orderStatusRows(orders []Order) [][]string {
+	rows := [][]string{{"order_number", "status", "reason", "changed_at"}}
+	for _, o := range orders {
+		for _, change := range o.StatusHistory {
+			rows = append(rows, []string{o.OrderNumber, string(change.Status), change.Reason, formatTime(change.ChangedAt)})
+		}
+	}
+	return rows
+}
+
+func paymentRows(payments []Payment) [][]string {
+	rows := [][]string{{"order_number", "provider", "status", "amount", "captured_amount", "currency", "created_at"}}
+	for _, p := range payments {
+		rows = append(rows, []string{p.OrderNumber, p.Provider, string(p.Status), p.Amount, p.CapturedAmount, p.Currency, formatTime(p.CreatedAt)})
+	}
+	return rows
+}
+
+func refundRows(refunds []Refund) [][]string {
+	rows := [][]string{{"order_number", "amount", "status", "reason", "created_at"}}
+	for _, r := range refunds {
+		rows = append(rows, []string{r.OrderNumber, r.Amount, string(r.Status), r.Reason, formatTime(r.CreatedAt)})
+	}
+	return rows
+}
+
+func returnRows(returns []Return) [][]string {
+	rows := [][]string{{"order_number", "status", "reason", "items", "created_at"}}
+	for _, r := range returns {
+		rows = append(rows, []string{r.OrderNumber, string(r.Status), r.Reason, strconv.Itoa(r.Items), formatTime(r.CreatedAt)})
+	}
+	return rows
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatTimePtr(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return formatTime(*t)
+}
@@ -0,0 +1,35 @@
+package privacy
+
+import (
+	"context"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/storage"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/utils"
+)
+
+// Erase anonymizes the user's data (see repository.EraseUser), then removes their files
+// and ends their sessions. Once the database part succeeded, cleanup failures are only logged.
+func Erase(ctx context.Context, userID uuid.UUID) error {
+	files, err := repository.EraseUser(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := utils.RevokeAllUserTokens(ctx, userID.String()); err != nil {
+		log.Printf("failed to revoke access tokens of erased user %s: %v", userID, err)
+	}
+	removeFiles(files.ExportPaths)
+	if files.AvatarURL != "" {
+		backend, err := storage.Default()
+		if err == nil {
+			err = backend.Delete(ctx, files.AvatarURL)
+		}
+		if err != nil {
+			log.Printf("failed to delete avatar of erased user %s: %v", userID, err)
+		}
+	}
+	return nil
+}
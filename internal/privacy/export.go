@@ -0,0 +1,147 @@
+// Package privacy builds data exports and erases accounts for data-subject requests.
+package privacy
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/repository"
+)
+
+const (
+	defaultExportTTL = 7 * 24 * time.Hour
+	// archives are built one or two at a time, they read a lot
+	maxConcurrentExports = 2
+)
+
+var exportSlots = make(chan struct{}, maxConcurrentExports)
+
+// ExportDir is where archives are written. It must not be served publicly,
+// downloads go through the authenticated endpoint.
+func ExportDir() string {
+	if dir := config.LoadEnv().DataExportDir; dir != "" {
+		return dir
+	}
+	return "exports"
+}
+
+func exportTTL() time.Duration {
+	return config.DurationOr(config.LoadEnv().DataExportTTL, defaultExportTTL)
+}
+
+// Enqueue builds the export in the background
+func Enqueue(exportID uuid.UUID) {
+	go func() {
+		exportSlots <- struct{}{}
+		defer func() { <-exportSlots }()
+
+		if err := build(exportID); err != nil {
+			log.Printf("data export %s failed: %v", exportID, err)
+		}
+		if err := PurgeExpired(); err != nil {
+			log.Println("Purging expired data exports failed:", err)
+		}
+	}()
+}
+
+// Resume restarts exports interrupted by a shutdown and deletes expired archives.
+// Called once at startup.
+func Resume() error {
+	if err := PurgeExpired(); err != nil {
+		return err
+	}
+	ids, err := repository.RequeueDataExports()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		Enqueue(id)
+	}
+	return nil
+}
+
+// PurgeExpired deletes archives that are past their download window
+func PurgeExpired() error {
+	paths, err := repository.TakeExpiredDataExports()
+	if err != nil {
+		return err
+	}
+	removeFiles(paths)
+	return nil
+}
+
+func build(exportID uuid.UUID) error {
+	export, err := repository.ClaimDataExport(exportID)
+	if err != nil {
+		if errors.Is(err, repository.ErrExportNotPending) {
+			return nil
+		}
+		return err
+	}
+
+	path, err := writeArchive(export)
+	if err != nil {
+		if failErr := repository.FailDataExport(export.ID, "could not build the archive"); failErr != nil {
+			log.Printf("failed to mark data export %s as failed: %v", export.ID, failErr)
+		}
+		return err
+	}
+
+	if err := repository.CompleteDataExport(export.ID, path, time.Now().Add(exportTTL())); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+func writeArchive(export *models.DataExport) (string, error) {
+	data, err := collect(export.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	dir := ExportDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, export.ID.String()+".zip")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", err
+	}
+
+	zw := zip.NewWriter(f)
+	switch export.Format {
+	case models.ExportCSV:
+		err = writeCSVFiles(zw, data)
+	default:
+		err = writeJSONFile(zw, data)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("writing %s: %w", path, err)
+	}
+	return path, nil
+}
+
+func removeFiles(paths []string) {
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("failed to delete data export %s: %v", path, err)
+		}
+	}
+}
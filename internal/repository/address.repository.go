@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxAddressesPerUser = 20
+
+var (
+	ErrAddressLimit           = errors.New("address book is full")
+	ErrShippingAddressMissing = errors.New("a shipping address is required")
+	ErrUnknownAddress         = errors.New("address does not exist")
+)
+
+func ListAddresses(userID uuid.UUID) ([]models.UserAddress, error) {
+	var addresses []models.UserAddress
+	err := config.DB.
+		Where("user_id = ?", userID).
+		Order("is_default_shipping DESC, is_default_billing DESC, created_at ASC").
+		Find(&addresses).
+		Error
+	return addresses, err
+}
+
+func GetAddress(userID uuid.UUID, id uuid.UUID) (*models.UserAddress, error) {
+	var address models.UserAddress
+	err := config.DB.First(&address, "id = ? AND user_id = ?", id, userID).Error
+	return &address, err
+}
+
+// CreateAddress adds an address to the user's book. The first address becomes
+// the default for both shipping and billing.
+func CreateAddress(address *models.UserAddress) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, address.UserID); err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.UserAddress{}).Where("user_id = ?", address.UserID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= maxAddressesPerUser {
+			return ErrAddressLimit
+		}
+		if count == 0 {
+			address.IsDefaultShipping = true
+			address.IsDefaultBilling = true
+		}
+
+		if err := clearOtherDefaults(tx, address); err != nil {
+			return err
+		}
+		return tx.Create(address).Error
+	})
+}
+
+// UpdateAddress replaces an address of the user. Orders keep the copy they were placed with.
+func UpdateAddress(address *models.UserAddress) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, address.UserID); err != nil {
+			return err
+		}
+
+		var existing models.UserAddress
+		if err := tx.First(&existing, "id = ? AND user_id = ?", address.ID, address.UserID).Error; err != nil {
+			return err
+		}
+
+		if err := clearOtherDefaults(tx, address); err != nil {
+			return err
+		}
+		address.CreatedAt = existing.CreatedAt
+		address.UpdatedAt = time.Now()
+		return tx.Model(&models.UserAddress{}).
+			Where("id = ?", address.ID).
+			Updates(map[string]interface{}{
+				"label":               address.Label,
+				"recipient":           address.Recipient,
+				"phone":               address.Phone,
+				"line1":               address.Line1,
+				"line2":               address.Line2,
+				"city":                address.City,
+				"region":              address.Region,
+				"postal_code":         address.PostalCode,
+				"country":             address.Country,
+				"is_default_shipping": address.IsDefaultShipping,
+				"is_default_billing":  address.IsDefaultBilling,
+				"updated_at":          address.UpdatedAt,
+			}).Error
+	})
+}
+
+// DeleteAddress removes an address. When it was a default, the most recently added
+// remaining address takes over that role.
+func DeleteAddress(userID uuid.UUID, id uuid.UUID) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, userID); err != nil {
+			return err
+		}
+
+		var address models.UserAddress
+		if err := tx.First(&address, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&address).Error; err != nil {
+			return err
+		}
+		if !address.IsDefaultShipping && !address.IsDefaultBilling {
+			return nil
+		}
+
+		var next models.UserAddress
+		err := tx.Where("user_id = ?", userID).Order("created_at DESC").First(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{"updated_at": time.Now()}
+		if address.IsDefaultShipping {
+			updates["is_default_shipping"] = true
+		}
+		if address.IsDefaultBilling {
+			updates["is_default_billing"] = true
+		}
+		return tx.Model(&models.UserAddress{}).Where("id = ?", next.ID).Updates(updates).Error
+	})
+}
+
+// lockUser locks the user's row to serialize changes to data owned by the user,
+// e.g. so two address updates can't both leave a default flag set
+func lockUser(tx *gorm.DB, userID uuid.UUID) error {
+	var user models.User
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		First(&user, "id = ?", userID).
+		Error
+}
+
+func clearOtherDefaults(tx *gorm.DB, address *models.UserAddress) error {
+	for column, set := range map[string]bool{
+		"is_default_shipping": address.IsDefaultShipping,
+		"is_default_billing":  address.IsDefaultBilling,
+	} {
+		if !set {
+			continue
+		}
+		if err := tx.Model(&models.UserAddress{}).
+			Where("user_id = ? AND id <> ? AND "+column, address.UserID, address.ID).
+			Updates(map[string]interface{}{
+				column:       false,
+				"updated_at": time.Now(),
+			}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkoutAddress picks the address with this id, or the user's default for the role
+// when id is nil. nil means the user has no such default.
+func checkoutAddress(tx *gorm.DB, userID uuid.UUID, id *uuid.UUID, defaultColumn string) (*models.UserAddress, error) {
+	var address models.UserAddress
+	query := tx.Where("user_id = ?", userID)
+	if id != nil {
+		query = query.Where("id = ?", *id)
+	} else {
+		query = query.Where(defaultColumn)
+	}
+
+	err := query.First(&address).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if id != nil {
+			return nil, ErrUnknownAddress
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &address, nil
+}
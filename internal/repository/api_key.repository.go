@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"gorm.io/gorm"
+)
+
+var ErrAPIKeyInvalid = errors.New("invalid API key")
+
+// how often last_used_at is written, so busy integrations don't update the row on every call
+const apiKeyTouchInterval = time.Minute
+
+func CreateAPIKey(key *models.APIKey) error {
+	return config.DB.Create(key).Error
+}
+
+func ListAPIKeys(userID uuid.UUID) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := config.DB.
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&keys).
+		Error
+	return keys, err
+}
+
+// RevokeAPIKey revokes one of the user's keys
+func RevokeAPIKey(userID uuid.UUID, keyID uuid.UUID) error {
+	result := config.DB.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// revokeAPIKeys revokes every active key of the user
+func revokeAPIKeys(tx *gorm.DB, userID uuid.UUID) error {
+	return tx.Model(&models.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).
+		Error
+}
+
+// GetActiveAPIKeyByHash returns the key if it isn't revoked or expired and its owner still exists
+func GetActiveAPIKeyByHash(keyHash string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := config.DB.
+		Joins("JOIN users ON users.id = api_keys.user_id AND users.deleted_at IS NULL").
+		Where("api_keys.key_hash = ? AND api_keys.revoked_at IS NULL", keyHash).
+		Where("api_keys.expires_at IS NULL OR api_keys.expires_at > ?", time.Now()).
+		First(&key).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAPIKeyInvalid
+	}
+	return &key, err
+}
+
+// TouchAPIKey records when and from where the key was last used
+func TouchAPIKey(key *models.APIKey, ip string) error {
+	now := time.Now()
+	if key.LastUsedAt != nil && now.Sub(*key.LastUsedAt) < apiKeyTouchInterval && key.LastUsedIP == ip {
+		return nil
+	}
+	return config.DB.Model(&models.APIKey{}).
+		Where("id = ?", key.ID).
+		Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": ip,
+		}).Error
+}
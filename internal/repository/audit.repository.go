@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"encoding/json"
+
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/helper"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"gorm.io/gorm"
+)
+
+// RecordAudit stores an audit entry, metadata is serialized as JSON
+func RecordAudit(entry models.AuditLog, metadata map[string]interface{}) error {
+	return recordAudit(config.DB, entry, metadata)
+}
+
+// recordAudit stores the entry with the change it describes, so one can't be kept without the other
+func recordAudit(tx *gorm.DB, entry models.AuditLog, metadata map[string]interface{}) error {
+	if len(metadata) > 0 {
+		raw, err := json.Marshal(metadata)
+		if err != nil {
+			return err
+		}
+		metadataJSON := string(raw)
+		entry.Metadata = &metadataJSON
+	}
+	return tx.Create(&entry).Error
+}
+
+// EnsureAuditLogAppendOnly installs triggers that reject any UPDATE, DELETE or TRUNCATE
+// on audit_logs, so entries can't be altered through the application's connection.
+// It's safe to run on every start.
+func EnsureAuditLogAppendOnly() error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_logs is append-only, % is not allowed', TG_OP;
+END;
+$$ LANGUAGE plpgsql`).Error; err != nil {
+			return err
+		}
+
+		triggers := map[string]string{
+			"audit_logs_no_change":   "BEFORE UPDATE OR DELETE ON audit_logs FOR EACH ROW",
+			"audit_logs_no_truncate": "BEFORE TRUNCATE ON audit_logs FOR EACH STATEMENT",
+		}
+		for name, when := range triggers {
+			var exists bool
+			if err := tx.Raw(
+				"SELECT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = ? AND tgrelid = 'audit_logs'::regclass)", name,
+			).Scan(&exists).Error; err != nil {
+				return err
+			}
+			if exists {
+				continue
+			}
+			if err := tx.Exec("CREATE TRIGGER " + name + " " + when + " EXECUTE FUNCTION audit_logs_append_only()").Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func filterAuditLogs(params helper.AuditLogFilterParams) *gorm.DB {
+	query := config.DB.Model(&models.AuditLog{})
+	if params.ActorID != nil {
+		query = query.Where("actor_id = ?", *params.ActorID)
+	}
+	if params.Action != "" {
+		query = query.Where("action = ?", params.Action)
+	}
+	if params.TargetType != "" {
+		query = query.Where("target_type = ?", params.TargetType)
+	}
+	if params.TargetID != "" {
+		query = query.Where("target_id = ?", params.TargetID)
+	}
+	if params.RequestID != "" {
+		query = query.Where("request_id = ?", params.RequestID)
+	}
+	if params.From != nil {
+		query = query.Where("created_at >= ?", *params.From)
+	}
+	if params.To != nil {
+		query = query.Where("created_at < ?", *params.To)
+	}
+	return query
+}
+
+// ListAuditLogs returns a page of audit entries, newest first, plus the total count for the filter
+func ListAuditLogs(params helper.AuditLogFilterParams) ([]models.AuditLog, int64, error) {
+	var entries []models.AuditLog
+	var total int64
+
+	query := filterAuditLogs(params)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.
+		Order("created_at DESC, id").
+		Limit(params.Limit).
+		Offset((params.Page - 1) * params.Limit).
+		Find(&entries).
+		Error
+	return entries, total, err
+}
+
+// EachAuditLog calls fn for every entry matching the filter, oldest first.
+// Rows are read one at a time so a large export doesn't have to fit in memory.
+func EachAuditLog(params helper.AuditLogFilterParams, fn func(entry *models.AuditLog) error) error {
+	rows, err := filterAuditLogs(params).Order("created_at, id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.AuditLog
+		if err := config.DB.ScanRows(rows, &entry); err != nil {
+			return err
+		}
+		if err := fn(&entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
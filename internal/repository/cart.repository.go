@@ -6,6 +6,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func GetCartByUserId(id uuid.UUID) (*models.Cart, error) {
@@ -67,3 +69,28 @@ func RemoveCartItemFrom(cartId uuid.UUID, productId uuid.UUID) error {
 		Delete(&models.CartItems{}).
 		Error
 }
+
+// DeleteCartByUserId removes a user's cart with all its items and returns what it held.
+// The cart is deleted for good so the user can create a new one.
+func DeleteCartByUserId(userId uuid.UUID) (*models.Cart, error) {
+	var cart models.Cart
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&cart, "user_id = ?", userId).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("cart_id = ?", cart.ID).Find(&cart.CartItems).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("cart_id = ?", cart.ID).Delete(&models.CartItems{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.Cart{}, "id = ?", cart.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &cart, nil
+}
@@ -1,19 +1,360 @@
 package repository
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/helper"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCartEmpty          = errors.New("cart is empty")
+	ErrProductUnavailable = errors.New("product is no longer available")
+	ErrInsufficientStock  = errors.New("insufficient stock")
+	ErrInvalidTransition  = errors.New("invalid order status transition")
+	ErrOrderNotCancelable = errors.New("order can no longer be cancelled")
 )
 
-func Checkout() (*models.Order, error) {
+// Checkout turns the cart into an order inside a single transaction.
+// The cart row and every product row in it are locked (SELECT ... FOR UPDATE)
+// so concurrent checkouts for the same products are serialized and can't oversell.
+// Products are locked in id order to avoid deadlocks between overlapping carts.
+// The chosen addresses are copied onto the order; billing falls back to the shipping address.
+func Checkout(cartID uuid.UUID, userID uuid.UUID, orderNumber string, addresses helper.CheckoutAddressParams) (*models.Order, error) {
 	var order models.Order
 
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var cart models.Cart
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&cart, "id = ? AND user_id = ?", cartID, userID).Error; err != nil {
+			return err
+		}
+
+		var items []models.CartItems
+		if err := tx.Where("cart_id = ?", cart.ID).Find(&items).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return ErrCartEmpty
+		}
+
+		shipping, err := checkoutAddress(tx, userID, addresses.ShippingAddressID, "is_default_shipping")
+		if err != nil {
+			return err
+		}
+		if shipping == nil && addresses.RequireShipping {
+			return ErrShippingAddressMissing
+		}
+		billing, err := checkoutAddress(tx, userID, addresses.BillingAddressID, "is_default_billing")
+		if err != nil {
+			return err
+		}
+		if billing == nil {
+			billing = shipping
+		}
+
+		productIDs := make([]uuid.UUID, 0, len(items))
+		for _, item := range items {
+			productIDs = append(productIDs, item.ProductID)
+		}
+
+		var products []models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", productIDs).
+			Order("id").
+			Find(&products).Error; err != nil {
+			return err
+		}
+
+		productsByID := make(map[uuid.UUID]models.Product, len(products))
+		for _, p := range products {
+			productsByID[p.ID] = p
+		}
+
+		hundred := decimal.NewFromInt(100)
+		subtotal := decimal.Zero
+		discount := decimal.Zero
+		orderItems := make([]models.OrderItem, 0, len(items))
+
+		for _, item := range items {
+			product, ok := productsByID[item.ProductID]
+			if !ok {
+				return ErrProductUnavailable
+			}
+			if product.NumberOfStock < item.Quantity {
+				return fmt.Errorf("%w: %s", ErrInsufficientStock, product.Name)
+			}
+
+			qty := decimal.NewFromInt(int64(item.Quantity))
+			lineTotal := product.BasePrice.Mul(qty)
+			lineDiscount := lineTotal.Mul(product.DiscountPercent).Div(hundred).Round(2)
+
+			subtotal = subtotal.Add(lineTotal)
+			discount = discount.Add(lineDiscount)
+
+			// snapshot product data at purchase time
+			orderItems = append(orderItems, models.OrderItem{
+				ProductID:       product.ID,
+				ProductName:     product.Name,
+				ProductPrice:    product.BasePrice,
+				DiscountPercent: product.DiscountPercent,
+				Quantity:        item.Quantity,
+				TotalPrice:      lineTotal.Sub(lineDiscount),
+			})
+		}
+
+		order = models.Order{
+			UserID:         userID,
+			OrderNumber:    orderNumber,
+			Status:         models.OrderPending,
+			Subtotal:       subtotal,
+			DiscountAmount: discount,
+			TotalAmount:    subtotal.Sub(discount),
+			OrderItems:     orderItems,
+
+			ShippingAddress: shipping.Snapshot(),
+			BillingAddress:  billing.Snapshot(),
+		}
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Create(&models.OrderStatusHistory{
+			OrderID:   order.ID,
+			ToStatus:  models.OrderPending,
+			ChangedBy: userID,
+			Reason:    "order placed",
+		}).Error; err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			if err := UpdateStock(tx, item.ProductID, item.Quantity); err != nil {
+				return err
+			}
+		}
+
+		// empty the cart
+		return tx.Unscoped().
+			Where("cart_id = ?", cart.ID).
+			Delete(&models.CartItems{}).
+			Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return &order, nil
 }
 
+// orderNumberSequence is created by a migration (migrations/*_order_number_seq.sql)
+const orderNumberSequence = "order_number_seq"
+
+// NextOrderNumberSequence returns the next value of the order number sequence.
+// nextval is atomic across connections, so concurrent checkouts never get the same value.
+func NextOrderNumberSequence() (int64, error) {
+	var seq int64
+	err := config.DB.Raw("SELECT nextval(?::regclass)", orderNumberSequence).Scan(&seq).Error
+	return seq, err
+}
+
 func CreateOrder(order *models.Order) (*models.Order, error) {
 	if err := config.DB.Create(order).Error; err != nil {
 		return nil, err
 	}
 	return order, nil
 }
+
+// ChangeOrderStatus moves an already locked order to a new status and records the change.
+// It must be called inside a transaction, see TransitionOrderStatus.
+func ChangeOrderStatus(tx *gorm.DB, order *models.Order, to models.OrderStatus, actorID uuid.UUID, reason string) error {
+	from := order.Status
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+
+	if err := tx.Model(&models.Order{}).
+		Where("id = ?", order.ID).
+		Updates(map[string]interface{}{
+			"status":     to,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Create(&models.OrderStatusHistory{
+		OrderID:    order.ID,
+		FromStatus: &from,
+		ToStatus:   to,
+		ChangedBy:  actorID,
+		Reason:     reason,
+	}).Error; err != nil {
+		return err
+	}
+
+	order.Status = to
+	return nil
+}
+
+// GetOrderForUpdate loads an order and locks its row until the transaction ends
+func GetOrderForUpdate(tx *gorm.DB, orderID uuid.UUID) (*models.Order, error) {
+	var order models.Order
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, "id = ?", orderID).Error
+	return &order, err
+}
+
+// TransitionOrderStatus changes the order's status and also returns the status it had before
+func TransitionOrderStatus(orderID uuid.UUID, to models.OrderStatus, actorID uuid.UUID, reason string) (*models.Order, models.OrderStatus, error) {
+	var order *models.Order
+	var from models.OrderStatus
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		order, err = GetOrderForUpdate(tx, orderID)
+		if err != nil {
+			return err
+		}
+		from = order.Status
+		// cancelling has side effects on stock and refunds
+		if to == models.OrderCancelled {
+			_, err = cancelOrder(tx, order, actorID, reason)
+			return err
+		}
+		return ChangeOrderStatus(tx, order, to, actorID, reason)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return order, from, nil
+}
+
+func GetOrderStatusHistory(orderID uuid.UUID) ([]models.OrderStatusHistory, error) {
+	var history []models.OrderStatusHistory
+	err := config.DB.
+		Where("order_id = ?", orderID).
+		Order("created_at ASC").
+		Find(&history).
+		Error
+	return history, err
+}
+
+func GetOrderByID(id uuid.UUID) (*models.Order, error) {
+	var order models.Order
+	err := config.DB.Preload("OrderItems").First(&order, "id = ?", id).Error
+	return &order, err
+}
+
+// ListOrders returns a page of orders, newest first, plus the total count for the filter
+func ListOrders(params helper.OrderFilterParams) ([]models.Order, int64, error) {
+	var orders []models.Order
+	var total int64
+	offset := (params.Page - 1) * params.Limit
+
+	query := config.DB.Model(&models.Order{})
+	if params.UserID != nil {
+		query = query.Where("user_id = ?", *params.UserID)
+	}
+	if params.Status != "" {
+		query = query.Where("status = ?", params.Status)
+	}
+	if params.From != nil {
+		query = query.Where("created_at >= ?", *params.From)
+	}
+	if params.To != nil {
+		query = query.Where("created_at < ?", *params.To)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.
+		Order("created_at DESC").
+		Limit(params.Limit).
+		Offset(offset).
+		Preload("OrderItems").
+		Find(&orders).
+		Error
+
+	return orders, total, err
+}
+
+// CancelOrder cancels a pending or paid order in one transaction: the status changes,
+// every item's quantity goes back to stock, and a refund is requested if the order was paid.
+func CancelOrder(orderID uuid.UUID, actorID uuid.UUID, reason string) (*models.Order, *models.Refund, error) {
+	var order *models.Order
+	var refund *models.Refund
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		order, err = GetOrderForUpdate(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != models.OrderPending && order.Status != models.OrderPaid {
+			return fmt.Errorf("%w: order is %s", ErrOrderNotCancelable, order.Status)
+		}
+		refund, err = cancelOrder(tx, order, actorID, reason)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return order, refund, nil
+}
+
+func cancelOrder(tx *gorm.DB, order *models.Order, actorID uuid.UUID, reason string) (*models.Refund, error) {
+	wasPaid := order.Status == models.OrderPaid || order.Status == models.OrderProcessing
+
+	if err := ChangeOrderStatus(tx, order, models.OrderCancelled, actorID, reason); err != nil {
+		return nil, err
+	}
+
+	// restore in product id order, same as checkout locks them, to avoid deadlocks
+	var items []models.OrderItem
+	if err := tx.Where("order_id = ?", order.ID).Order("product_id").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if err := RestoreStock(tx, item.ProductID, item.Quantity); err != nil {
+			return nil, err
+		}
+	}
+
+	if !wasPaid {
+		return nil, nil
+	}
+
+	// refund whatever partial refunds haven't already given back
+	captured, err := capturedTotal(tx, order.ID)
+	if errors.Is(err, ErrNothingToRefund) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	committed, err := committedTotal(tx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	left := captured.Sub(committed)
+	if !left.IsPositive() {
+		return nil, nil
+	}
+
+	return createRefund(tx, helper.RefundParams{
+		OrderID: order.ID,
+		ActorID: actorID,
+		Amount:  left,
+		Reason:  reason,
+	})
+}
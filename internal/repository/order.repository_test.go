@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/helper"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// connectTestDB connects to the database in TEST_DB_URL and makes sure the schema exists.
+// Tests that need Postgres are skipped when it isn't set.
+func connectTestDB(t *testing.T) {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DB_URL")
+	if dsn == "" {
+		t.Skip("TEST_DB_URL is not set")
+	}
+	if _, err := config.Connect(dsn); err != nil {
+		t.Fatalf("connecting to test database: %v", err)
+	}
+
+	// the enum types aren't created by AutoMigrate
+	if err := config.DB.Exec(`DO $$ BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'order_status') THEN
+			CREATE TYPE order_status AS ENUM ('pending', 'paid', 'processing', 'shipped', 'delivered', 'cancelled', 'refunded');
+		END IF;
+		IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'product_status') THEN
+			CREATE TYPE product_status AS ENUM ('draft', 'active', 'inactive', 'archived');
+		END IF;
+	END $$`).Error; err != nil {
+		t.Fatalf("creating enum types: %v", err)
+	}
+	if err := config.AutoMigrate(config.DB); err != nil {
+		t.Fatalf("migrating test database: %v", err)
+	}
+}
+
+// TestCheckoutDoesNotOversell races more checkouts than there is stock for one product.
+// Exactly as many as there are units may succeed, the rest must fail with ErrInsufficientStock.
+func TestCheckoutDoesNotOversell(t *testing.T) {
+	connectTestDB(t)
+
+	const (
+		stock     = 3
+		customers = 10
+	)
+	run := uuid.NewString()[:8]
+
+	var userIDs []uuid.UUID
+	t.Cleanup(func() {
+		config.DB.Exec("DELETE FROM order_status_history WHERE order_id IN (SELECT id FROM orders WHERE user_id IN ?)", userIDs)
+		config.DB.Exec("DELETE FROM order_items WHERE order_id IN (SELECT id FROM orders WHERE user_id IN ?)", userIDs)
+		config.DB.Exec("DELETE FROM orders WHERE user_id IN ?", userIDs)
+		config.DB.Exec("DELETE FROM cart_items WHERE cart_id IN (SELECT id FROM carts WHERE user_id IN ?)", userIDs)
+		config.DB.Exec("DELETE FROM carts WHERE user_id IN ?", userIDs)
+		config.DB.Exec("DELETE FROM user_addresses WHERE user_id IN ?", userIDs)
+		config.DB.Exec("DELETE FROM products WHERE created_by IN ?", userIDs)
+		config.DB.Exec("DELETE FROM users WHERE id IN ?", userIDs)
+	})
+
+	newUser := func(i int) models.User {
+		user := models.User{
+			Fullname: "Checkout Test",
+			Username: fmt.Sprintf("checkout-%s-%d", run, i),
+			Email:    fmt.Sprintf("checkout-%s-%d@example.com", run, i),
+			Password: "!",
+		}
+		if err := config.DB.Create(&user).Error; err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+		userIDs = append(userIDs, user.ID)
+		return user
+	}
+
+	seller := newUser(-1)
+	product := models.Product{
+		Name:          "Limited item " + run,
+		BasePrice:     decimal.NewFromInt(100),
+		NumberOfStock: stock,
+		Status:        models.ProductActive,
+		CreatedBy:     seller.ID,
+	}
+	if err := config.DB.Create(&product).Error; err != nil {
+		t.Fatalf("creating product: %v", err)
+	}
+
+	carts := make([]models.Cart, customers)
+	for i := range carts {
+		user := newUser(i)
+		if err := config.DB.Create(&models.UserAddress{
+			UserID:            user.ID,
+			Recipient:         user.Fullname,
+			Line1:             "1 Test Street",
+			City:              "Testville",
+			Country:           "US",
+			IsDefaultShipping: true,
+			IsDefaultBilling:  true,
+		}).Error; err != nil {
+			t.Fatalf("creating address: %v", err)
+		}
+		carts[i] = models.Cart{UserID: user.ID}
+		if err := config.DB.Create(&carts[i]).Error; err != nil {
+			t.Fatalf("creating cart: %v", err)
+		}
+		if err := config.DB.Create(&models.CartItems{CartID: carts[i].ID, ProductID: product.ID, Quantity: 1}).Error; err != nil {
+			t.Fatalf("creating cart item: %v", err)
+		}
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+		start     = make(chan struct{})
+	)
+	for i, cart := range carts {
+		wg.Add(1)
+		go func(i int, cart models.Cart) {
+			defer wg.Done()
+			<-start
+
+			_, err := Checkout(cart.ID, cart.UserID, fmt.Sprintf("T%s-%d", run, i), helper.CheckoutAddressParams{})
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case !errors.Is(err, ErrInsufficientStock):
+				t.Errorf("checkout %d: unexpected error: %v", i, err)
+			}
+		}(i, cart)
+	}
+	close(start)
+	wg.Wait()
+
+	if succeeded != stock {
+		t.Errorf("%d checkouts succeeded, want %d", succeeded, stock)
+	}
+
+	var remaining models.Product
+	if err := config.DB.First(&remaining, "id = ?", product.ID).Error; err != nil {
+		t.Fatalf("reloading product: %v", err)
+	}
+	if remaining.NumberOfStock != 0 {
+		t.Errorf("stock is %d after checkout, want 0", remaining.NumberOfStock)
+	}
+
+	var orders int64
+	if err := config.DB.Model(&models.Order{}).Where("user_id IN ?", userIDs).Count(&orders).Error; err != nil {
+		t.Fatalf("counting orders: %v", err)
+	}
+	if orders != stock {
+		t.Errorf("%d orders were created, want %d", orders, stock)
+	}
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreatePayment stores a new payment. created is false when the order already has an open
+// payment, because a concurrent request started one first (see uq_payment_open_order).
+func CreatePayment(payment *models.Payment) (created bool, err error) {
+	result := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(payment)
+	return result.RowsAffected > 0, result.Error
+}
+
+func GetPaymentByID(id uuid.UUID) (*models.Payment, error) {
+	var payment models.Payment
+	err := config.DB.Preload("Order").First(&payment, "id = ?", id).Error
+	return &payment, err
+}
+
+// GetOpenPaymentForOrder returns the payment still waiting for confirmation or capture, if any
+func GetOpenPaymentForOrder(orderID uuid.UUID) (*models.Payment, error) {
+	var payment models.Payment
+	err := config.DB.
+		Where("order_id = ? AND status IN ?", orderID, []models.PaymentStatus{models.PaymentPending, models.PaymentAuthorized}).
+		Order("created_at DESC").
+		First(&payment).
+		Error
+	return &payment, err
+}
+
+// UpdatePaymentStatus is used for every state except captured, see MarkPaymentCaptured
+func UpdatePaymentStatus(paymentID uuid.UUID, status models.PaymentStatus, failureReason string) error {
+	return config.DB.
+		Model(&models.Payment{}).
+		Where("id = ? AND status IN ?", paymentID, []models.PaymentStatus{models.PaymentPending, models.PaymentAuthorized}).
+		Updates(map[string]interface{}{
+			"status":         status,
+			"failure_reason": failureReason,
+			"updated_at":     time.Now(),
+		}).Error
+}
+
+// MarkPaymentCaptured records a confirmed capture and moves the order to paid in the same transaction.
+// Calling it again for an already captured payment is a no-op, so provider retries are safe.
+// If the order was cancelled while the payment was in flight, a refund is requested instead.
+func MarkPaymentCaptured(paymentID uuid.UUID, amount decimal.Decimal) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var payment models.Payment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&payment, "id = ?", paymentID).Error; err != nil {
+			return err
+		}
+		if payment.Status == models.PaymentCaptured {
+			return nil
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.Payment{}).
+			Where("id = ?", payment.ID).
+			Updates(map[string]interface{}{
+				"status":          models.PaymentCaptured,
+				"captured_amount": amount,
+				"captured_at":     now,
+				"updated_at":      now,
+			}).Error; err != nil {
+			return err
+		}
+
+		order, err := GetOrderForUpdate(tx, payment.OrderID)
+		if err != nil {
+			return err
+		}
+
+		switch order.Status {
+		case models.OrderPending:
+			return ChangeOrderStatus(tx, order, models.OrderPaid, models.SystemActorID, "payment captured")
+		case models.OrderCancelled:
+			return tx.Create(&models.Refund{
+				OrderID:     order.ID,
+				PaymentID:   &payment.ID,
+				Amount:      amount,
+				Status:      models.RefundRequested,
+				Reason:      "payment captured after the order was cancelled",
+				RequestedBy: models.SystemActorID,
+			}).Error
+		}
+		return nil
+	})
+}
+
+func GetPaymentByProviderRef(provider string, reference string) (*models.Payment, error) {
+	var payment models.Payment
+	err := config.DB.First(&payment, "provider = ? AND provider_ref = ?", provider, reference).Error
+	return &payment, err
+}
+
+// TouchPaymentLastEvent remembers the newest event applied, used to spot out-of-order webhooks
+func TouchPaymentLastEvent(paymentID uuid.UUID, occurredAt time.Time) error {
+	return config.DB.
+		Model(&models.Payment{}).
+		Where("id = ? AND (last_event_at IS NULL OR last_event_at < ?)", paymentID, occurredAt).
+		Update("last_event_at", occurredAt).
+		Error
+}
+
+// SaveWebhookEvent inserts the event unless the provider already sent it,
+// and returns the stored row either way.
+func SaveWebhookEvent(event *models.PaymentWebhookEvent) (*models.PaymentWebhookEvent, error) {
+	if err := config.DB.
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(event).Error; err != nil {
+		return nil, err
+	}
+
+	var stored models.PaymentWebhookEvent
+	err := config.DB.First(&stored, "provider = ? AND event_id = ?", event.Provider, event.EventID).Error
+	return &stored, err
+}
+
+func UpdateWebhookEvent(event *models.PaymentWebhookEvent) error {
+	return config.DB.
+		Model(&models.PaymentWebhookEvent{}).
+		Where("id = ?", event.ID).
+		Updates(map[string]interface{}{
+			"status":       event.Status,
+			"error":        event.Error,
+			"attempts":     event.Attempts,
+			"payment_id":   event.PaymentID,
+			"processed_at": event.ProcessedAt,
+		}).Error
+}
+
+func GetWebhookEventByID(id uuid.UUID) (*models.PaymentWebhookEvent, error) {
+	var event models.PaymentWebhookEvent
+	err := config.DB.First(&event, "id = ?", id).Error
+	return &event, err
+}
+
+func ListWebhookEvents(status string, page int, limit int) ([]models.PaymentWebhookEvent, int64, error) {
+	var events []models.PaymentWebhookEvent
+	var total int64
+
+	query := config.DB.Model(&models.PaymentWebhookEvent{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.
+		Order("received_at DESC").
+		Limit(limit).
+		Offset((page - 1) * limit).
+		Find(&events).
+		Error
+	return events, total, err
+}
@@ -0,0 +1,329 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrExportInProgress = errors.New("a data export is already being prepared")
+	ErrExportNotPending = errors.New("data export is not waiting to be built")
+	ErrAlreadyErased    = errors.New("account data was already erased")
+	ErrErasureBlocked   = errors.New("account has orders in progress")
+)
+
+// erasure waits until these orders are finished, their addresses are still needed
+var erasureBlockedStatuses = []models.OrderStatus{models.OrderPending, models.OrderPaid, models.OrderProcessing, models.OrderShipped}
+
+// CreateDataExport queues an export. A user has at most one export being built at a time.
+func CreateDataExport(userID uuid.UUID, format models.DataExportFormat) (*models.DataExport, error) {
+	export := models.DataExport{UserID: userID, Format: format, Status: models.ExportPending}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, userID); err != nil {
+			return err
+		}
+
+		var active int64
+		if err := tx.Model(&models.DataExport{}).
+			Where("user_id = ? AND status IN ?", userID, []models.DataExportStatus{models.ExportPending, models.ExportProcessing}).
+			Count(&active).Error; err != nil {
+			return err
+		}
+		if active > 0 {
+			return ErrExportInProgress
+		}
+		return tx.Create(&export).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func GetDataExport(userID uuid.UUID, id uuid.UUID) (*models.DataExport, error) {
+	var export models.DataExport
+	err := config.DB.First(&export, "id = ? AND user_id = ?", id, userID).Error
+	return &export, err
+}
+
+func ListDataExports(userID uuid.UUID) ([]models.DataExport, error) {
+	var exports []models.DataExport
+	err := config.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&exports).Error
+	return exports, err
+}
+
+// ClaimDataExport moves a pending export to processing, so only one worker builds it
+func ClaimDataExport(id uuid.UUID) (*models.DataExport, error) {
+	var export models.DataExport
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&export, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if export.Status != models.ExportPending {
+			return ErrExportNotPending
+		}
+		export.Status = models.ExportProcessing
+		return tx.Model(&models.DataExport{}).Where("id = ?", id).Update("status", export.Status).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// CompleteDataExport records the built archive. gorm.ErrRecordNotFound means the export
+// was removed meanwhile (the account was erased) and the file should go too.
+func CompleteDataExport(id uuid.UUID, filePath string, expiresAt time.Time) error {
+	result := config.DB.Model(&models.DataExport{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":       models.ExportReady,
+			"file_path":    filePath,
+			"completed_at": time.Now(),
+			"expires_at":   expiresAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func FailDataExport(id uuid.UUID, reason string) error {
+	return config.DB.Model(&models.DataExport{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":       models.ExportFailed,
+			"error":        reason,
+			"completed_at": time.Now(),
+		}).Error
+}
+
+// RequeueDataExports puts exports interrupted by a restart back to pending and returns
+// every export still waiting to be built
+func RequeueDataExports() ([]uuid.UUID, error) {
+	if err := config.DB.Model(&models.DataExport{}).
+		Where("status = ?", models.ExportProcessing).
+		Update("status", models.ExportPending).Error; err != nil {
+		return nil, err
+	}
+
+	var ids []uuid.UUID
+	err := config.DB.Model(&models.DataExport{}).
+		Where("status = ?", models.ExportPending).
+		Order("created_at").
+		Pluck("id", &ids).
+		Error
+	return ids, err
+}
+
+// TakeExpiredDataExports forgets the archives past their expiry and returns their
+// file paths for the caller to delete
+func TakeExpiredDataExports() ([]string, error) {
+	var exports []models.DataExport
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("file_path <> '' AND expires_at < ?", time.Now()).
+			Find(&exports).Error; err != nil {
+			return err
+		}
+		if len(exports) == 0 {
+			return nil
+		}
+		ids := make([]uuid.UUID, 0, len(exports))
+		for _, e := range exports {
+			ids = append(ids, e.ID)
+		}
+		return tx.Model(&models.DataExport{}).Where("id IN ?", ids).Update("file_path", "").Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(exports))
+	for _, e := range exports {
+		paths = append(paths, e.FilePath)
+	}
+	return paths, nil
+}
+
+// UserOrderData is everything tied to a user's orders, for data exports
+type UserOrderData struct {
+	Orders   []models.Order
+	Payments []models.Payment
+	Refunds  []models.Refund
+	Returns  []models.ReturnRequest
+}
+
+func GetUserOrderData(userID uuid.UUID) (*UserOrderData, error) {
+	var data UserOrderData
+	if err := config.DB.
+		Preload("OrderItems").
+		Preload("StatusHistory", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC") }).
+		Where("user_id = ?", userID).
+		Order("created_at ASC").
+		Find(&data.Orders).Error; err != nil {
+		return nil, err
+	}
+	if len(data.Orders) == 0 {
+		return &data, nil
+	}
+
+	orderIDs := make([]uuid.UUID, 0, len(data.Orders))
+	for _, o := range data.Orders {
+		orderIDs = append(orderIDs, o.ID)
+	}
+	if err := config.DB.Where("order_id IN ?", orderIDs).Order("created_at ASC").Find(&data.Payments).Error; err != nil {
+		return nil, err
+	}
+	if err := config.DB.Where("order_id IN ?", orderIDs).Order("created_at ASC").Find(&data.Refunds).Error; err != nil {
+		return nil, err
+	}
+	if err := config.DB.Preload("Items").Where("user_id = ?", userID).Order("created_at ASC").Find(&data.Returns).Error; err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// GetUserCartItems lists the cart with product names, including products deleted since
+func GetUserCartItems(userID uuid.UUID) ([]models.CartItems, error) {
+	var items []models.CartItems
+	err := config.DB.
+		Joins("JOIN carts ON carts.id = cart_items.cart_id").
+		Where("carts.user_id = ?", userID).
+		Preload("Product", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Order("cart_items.added_at ASC").
+		Find(&items).
+		Error
+	return items, err
+}
+
+func GetUserIdentities(userID uuid.UUID) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	err := config.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&identities).Error
+	return identities, err
+}
+
+// ErasedUserFiles are files of an erased user that the caller has to delete
+type ErasedUserFiles struct {
+	AvatarURL   string
+	ExportPaths []string
+}
+
+// EraseUser anonymizes a user's personal data. Orders, payments and refunds stay for
+// bookkeeping, but the addresses copied onto orders lose everything except country and region.
+// Addresses, cart, sessions, credentials and linked accounts are removed, and the account
+// is soft deleted so it can't be used anymore.
+func EraseUser(userID uuid.UUID) (*ErasedUserFiles, error) {
+	files := ErasedUserFiles{}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		// erased users are soft deleted, they are looked up anyway to report it
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id = ?", userID).Error; err != nil {
+			return err
+		}
+		if user.ErasedAt != nil {
+			return ErrAlreadyErased
+		}
+
+		var inProgress int64
+		if err := tx.Model(&models.Order{}).
+			Where("user_id = ? AND status IN ?", userID, erasureBlockedStatuses).
+			Count(&inProgress).Error; err != nil {
+			return err
+		}
+		if inProgress > 0 {
+			return fmt.Errorf("%w: %d not finished yet", ErrErasureBlocked, inProgress)
+		}
+
+		files.AvatarURL = user.AvatarURL
+		if err := tx.Model(&models.DataExport{}).
+			Where("user_id = ? AND file_path <> ''", userID).
+			Pluck("file_path", &files.ExportPaths).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		// emails and usernames are unique, so the placeholders carry the id
+		if err := tx.Unscoped().Model(&models.User{}).
+			Where("id = ?", userID).
+			Updates(map[string]interface{}{
+				"fullname":          "Deleted user",
+				"username":          "deleted-" + userID.String(),
+				"email":             "deleted+" + userID.String() + "@invalid",
+				"password":          "!",
+				"email_verified_at": nil,
+				"avatar_url":        "",
+				"erased_at":         now,
+				"updated_at":        now,
+				"deleted_at":        now,
+			}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Order{}).
+			Where("user_id = ?", userID).
+			Updates(map[string]interface{}{
+				"shipping_recipient":   "",
+				"shipping_phone":       "",
+				"shipping_line1":       "",
+				"shipping_line2":       "",
+				"shipping_city":        "",
+				"shipping_postal_code": "",
+				"billing_recipient":    "",
+				"billing_phone":        "",
+				"billing_line1":        "",
+				"billing_line2":        "",
+				"billing_city":         "",
+				"billing_postal_code":  "",
+			}).Error; err != nil {
+			return err
+		}
+
+		// free text the customer wrote may name them
+		if err := tx.Model(&models.ReturnRequest{}).
+			Where("user_id = ?", userID).
+			Update("reason", "[erased]").Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec(
+			"DELETE FROM cart_items WHERE cart_id IN (SELECT id FROM carts WHERE user_id = ?)", userID,
+		).Error; err != nil {
+			return err
+		}
+
+		for _, model := range []interface{}{
+			&models.Cart{},
+			&models.UserAddress{},
+			&models.RefreshToken{},
+			&models.UserToken{},
+			&models.UserTOTP{},
+			&models.RecoveryCode{},
+			&models.APIKey{},
+			&models.UserIdentity{},
+			&models.UserRole{},
+			&models.DataExport{},
+		} {
+			if err := tx.Unscoped().Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &files, nil
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func CreateProduct(product *models.Product) (*models.Product, error) {
@@ -29,18 +30,76 @@ func GetProductByUUID(id uuid.UUID) (*models.Product, error) {
 	return &product, err
 }
 
-func UpdateProduct(product *models.Product) error {
-	return config.DB.
-		Model(&models.Product{}).
-		Where("id = ?", product.ID).
-		Updates(product).
-		Error
+// ProductAudit builds the audit entry for a product change from the row before and after it.
+// after is nil for a deletion.
+type ProductAudit func(before *models.Product, after *models.Product) (models.AuditLog, map[string]interface{})
+
+// UpdateProduct applies the non-zero fields of product and returns the row
+// as it was before and after. The audit entry is written in the same transaction.
+func UpdateProduct(product *models.Product, audit ProductAudit) (*models.Product, *models.Product, error) {
+	var before, after models.Product
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&before, "id = ?", product.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Product{}).
+			Where("id = ?", product.ID).
+			Updates(product).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&after, "id = ?", product.ID).Error; err != nil {
+			return err
+		}
+
+		entry, metadata := audit(&before, &after)
+		return recordAudit(tx, entry, metadata)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &before, &after, nil
+}
+
+// DeleteProduct soft deletes a product and returns it as it was.
+// Orders keep pointing at it, they load products unscoped.
+// The audit entry is written in the same transaction.
+func DeleteProduct(id uuid.UUID, audit ProductAudit) (*models.Product, error) {
+	var product models.Product
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&product, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.Product{}, "id = ?", id).Error; err != nil {
+			return err
+		}
+
+		entry, metadata := audit(&product, nil)
+		return recordAudit(tx, entry, metadata)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &product, nil
 }
 
 // for transactional purposes
 func UpdateStock(db *gorm.DB, productID uuid.UUID, qty int) error {
 	return db.Model(&models.Product{}).
 		Where("id = ?", productID).
-		Update("stock", gorm.Expr("stock - ?", qty)).
+		Update("number_of_stock", gorm.Expr("number_of_stock - ?", qty)).
+		Error
+}
+
+// RestoreStock puts quantity back, e.g. when an order is cancelled
+func RestoreStock(db *gorm.DB, productID uuid.UUID, qty int) error {
+	return db.Model(&models.Product{}).
+		Where("id = ?", productID).
+		Update("number_of_stock", gorm.Expr("number_of_stock + ?", qty)).
 		Error
 }
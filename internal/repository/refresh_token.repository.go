@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token has expired")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used")
+)
+
+func CreateRefreshToken(token *models.RefreshToken) error {
+	return config.DB.Create(token).Error
+}
+
+// RotateRefreshToken exchanges the token with this hash for next, which joins the same family.
+// Presenting a token that was already rotated or revoked means it leaked, so the whole
+// family is revoked and ErrRefreshTokenReused is returned.
+func RotateRefreshToken(tokenHash string, next *models.RefreshToken) (*models.RefreshToken, error) {
+	var current models.RefreshToken
+	reused := false
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&current, "token_hash = ?", tokenHash).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRefreshTokenInvalid
+			}
+			return err
+		}
+
+		now := time.Now()
+		if current.UsedAt != nil || current.RevokedAt != nil {
+			// commit the revocation, the caller still gets an error
+			reused = true
+			return revokeRefreshTokens(tx.Where("family_id = ?", current.FamilyID), now)
+		}
+		if now.After(current.ExpiresAt) {
+			return ErrRefreshTokenExpired
+		}
+
+		next.UserID = current.UserID
+		next.FamilyID = current.FamilyID
+		next.MFA = current.MFA
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.RefreshToken{}).
+			Where("id = ?", current.ID).
+			Updates(map[string]interface{}{
+				"used_at":     now,
+				"replaced_by": next.ID,
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return &current, ErrRefreshTokenReused
+	}
+
+	return &current, nil
+}
+
+func GetRefreshTokenByHash(tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := config.DB.First(&token, "token_hash = ?", tokenHash).Error
+	return &token, err
+}
+
+func RevokeRefreshTokenFamily(familyID uuid.UUID) error {
+	return revokeRefreshTokens(config.DB.Where("family_id = ?", familyID), time.Now())
+}
+
+func RevokeAllUserRefreshTokens(userID uuid.UUID) error {
+	return revokeRefreshTokens(config.DB.Where("user_id = ?", userID), time.Now())
+}
+
+func revokeRefreshTokens(scope *gorm.DB, now time.Time) error {
+	return scope.Model(&models.RefreshToken{}).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", now).
+		Error
+}
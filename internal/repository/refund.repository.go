@@ -0,0 +1,366 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/helper"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNothingToRefund       = errors.New("order has no captured payment")
+	ErrRefundExceedsCaptured = errors.New("refund exceeds the captured amount")
+	ErrInvalidRefundItem     = errors.New("invalid refund item")
+	ErrRefundNotPending      = errors.New("refund is not awaiting processing")
+)
+
+// CreateRefund validates and stores a refund request. The order row is locked so two
+// refunds created at the same time can't together exceed what was captured.
+// Refunds that haven't failed count against the captured amount, including unprocessed ones.
+func CreateRefund(params helper.RefundParams) (*models.Refund, error) {
+	var refund *models.Refund
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		refund, err = createRefund(tx, params)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return refund, nil
+}
+
+func createRefund(tx *gorm.DB, params helper.RefundParams) (*models.Refund, error) {
+	order, err := GetOrderForUpdate(tx, params.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := params.Amount
+	var refundItems []models.RefundItem
+	if len(params.Items) > 0 {
+		amount, refundItems, err = priceRefundItems(tx, order.ID, params.Items)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !amount.IsPositive() {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidRefundItem)
+	}
+
+	captured, err := capturedTotal(tx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	committed, err := committedTotal(tx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	if committed.Add(amount).GreaterThan(captured) {
+		return nil, fmt.Errorf("%w: %s already refunded or pending, %s captured", ErrRefundExceedsCaptured, committed.StringFixed(2), captured.StringFixed(2))
+	}
+
+	payment, err := refundablePayment(tx, order.ID, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	refund := models.Refund{
+		OrderID:     order.ID,
+		PaymentID:   &payment.ID,
+		Amount:      amount,
+		Status:      models.RefundRequested,
+		Reason:      params.Reason,
+		RequestedBy: params.ActorID,
+		// a cancelled order already had its stock restored
+		Restock: params.Restock && len(refundItems) > 0 && order.Status != models.OrderCancelled,
+		Items:   refundItems,
+	}
+	if err := tx.Create(&refund).Error; err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+// capturedTotal returns what was captured over all of the order's payments
+func capturedTotal(tx *gorm.DB, orderID uuid.UUID) (decimal.Decimal, error) {
+	var captured decimal.Decimal
+	err := tx.Model(&models.Payment{}).
+		Where("order_id = ? AND status = ?", orderID, models.PaymentCaptured).
+		Select("COALESCE(SUM(captured_amount), 0)").
+		Scan(&captured).
+		Error
+	if err == nil && !captured.IsPositive() {
+		err = ErrNothingToRefund
+	}
+	return captured, err
+}
+
+// committedTotal returns what the order's refunds add up to, refunded or still pending
+func committedTotal(tx *gorm.DB, orderID uuid.UUID) (decimal.Decimal, error) {
+	var committed decimal.Decimal
+	err := tx.Model(&models.Refund{}).
+		Where("order_id = ? AND status <> ?", orderID, models.RefundFailed).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&committed).
+		Error
+	return committed, err
+}
+
+// refundablePayment picks the payment a refund goes back to. The provider refunds one payment
+// at a time, so it has to be a single payment with enough left, the newest one that has.
+// What is left counts every refund against the payment that hasn't failed.
+func refundablePayment(tx *gorm.DB, orderID uuid.UUID, amount decimal.Decimal) (*models.Payment, error) {
+	var payments []models.Payment
+	if err := tx.
+		Where("order_id = ? AND status = ?", orderID, models.PaymentCaptured).
+		Order("captured_at DESC").
+		Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	if len(payments) == 0 {
+		return nil, ErrNothingToRefund
+	}
+
+	for i := range payments {
+		var refunded decimal.Decimal
+		if err := tx.Model(&models.Refund{}).
+			Where("payment_id = ? AND status <> ?", payments[i].ID, models.RefundFailed).
+			Select("COALESCE(SUM(amount), 0)").
+			Scan(&refunded).Error; err != nil {
+			return nil, err
+		}
+		if payments[i].CapturedAmount.Sub(refunded).GreaterThanOrEqual(amount) {
+			return &payments[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no single payment has %s left to refund, split the refund", ErrRefundExceedsCaptured, amount.StringFixed(2))
+}
+
+// priceRefundItems works out what the customer paid for the returned quantities.
+// The last units of an item get whatever is left so rounding never adds up to more than the line total.
+func priceRefundItems(tx *gorm.DB, orderID uuid.UUID, params []helper.RefundItemParams) (decimal.Decimal, []models.RefundItem, error) {
+	total := decimal.Zero
+	items := make([]models.RefundItem, 0, len(params))
+
+	for _, p := range params {
+		if p.Quantity < 1 {
+			return decimal.Zero, nil, fmt.Errorf("%w: quantity must be at least 1", ErrInvalidRefundItem)
+		}
+
+		var orderItem models.OrderItem
+		if err := tx.First(&orderItem, "id = ? AND order_id = ?", p.OrderItemID, orderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return decimal.Zero, nil, fmt.Errorf("%w: %s is not part of this order", ErrInvalidRefundItem, p.OrderItemID)
+			}
+			return decimal.Zero, nil, err
+		}
+
+		var already struct {
+			Quantity int
+			Amount   decimal.Decimal
+		}
+		if err := tx.Table("refund_items").
+			Joins("JOIN refunds ON refunds.id = refund_items.refund_id").
+			Where("refund_items.order_item_id = ? AND refunds.status <> ?", orderItem.ID, models.RefundFailed).
+			Select("COALESCE(SUM(refund_items.quantity), 0) AS quantity, COALESCE(SUM(refund_items.amount), 0) AS amount").
+			Scan(&already).Error; err != nil {
+			return decimal.Zero, nil, err
+		}
+		// the same item may be listed more than once in this refund
+		for _, priced := range items {
+			if priced.OrderItemID == orderItem.ID {
+				already.Quantity += priced.Quantity
+				already.Amount = already.Amount.Add(priced.Amount)
+			}
+		}
+
+		remaining := orderItem.Quantity - already.Quantity
+		if p.Quantity > remaining {
+			return decimal.Zero, nil, fmt.Errorf("%w: only %d of %s can still be refunded", ErrInvalidRefundItem, remaining, orderItem.ProductName)
+		}
+
+		var amount decimal.Decimal
+		if p.Quantity == remaining {
+			amount = orderItem.TotalPrice.Sub(already.Amount)
+		} else {
+			unit := orderItem.TotalPrice.Div(decimal.NewFromInt(int64(orderItem.Quantity)))
+			amount = unit.Mul(decimal.NewFromInt(int64(p.Quantity))).Round(2)
+		}
+
+		total = total.Add(amount)
+		items = append(items, models.RefundItem{
+			OrderItemID: orderItem.ID,
+			Quantity:    p.Quantity,
+			Amount:      amount,
+		})
+	}
+
+	return total, items, nil
+}
+
+func GetRefundByID(id uuid.UUID) (*models.Refund, error) {
+	var refund models.Refund
+	err := config.DB.Preload("Items").First(&refund, "id = ?", id).Error
+	return &refund, err
+}
+
+func GetRefundsByOrder(orderID uuid.UUID) ([]models.Refund, error) {
+	var refunds []models.Refund
+	err := config.DB.
+		Preload("Items").
+		Where("order_id = ?", orderID).
+		Order("created_at ASC").
+		Find(&refunds).
+		Error
+	return refunds, err
+}
+
+// ClaimRefund marks a requested refund as being processed. Only one caller can win,
+// so the provider is never asked to refund the same request twice at the same time.
+// A refund stuck in processing for longer than staleAfter, e.g. because the process died
+// while waiting for the provider, can be claimed again; the provider call is idempotent per refund.
+// The payment to refund against is resolved here for requests created without one.
+func ClaimRefund(refundID uuid.UUID, staleAfter time.Duration) (*models.Refund, *models.Payment, error) {
+	var refund models.Refund
+	var payment *models.Payment
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&refund, "id = ?", refundID).Error; err != nil {
+			return err
+		}
+		stale := refund.Status == models.RefundProcessing && time.Since(refund.UpdatedAt) > staleAfter
+		if refund.Status != models.RefundRequested && !stale {
+			return ErrRefundNotPending
+		}
+
+		if refund.PaymentID != nil {
+			payment = &models.Payment{}
+			if err := tx.First(payment, "id = ?", *refund.PaymentID).Error; err != nil {
+				return err
+			}
+		} else {
+			var err error
+			if payment, err = refundablePayment(tx, refund.OrderID, refund.Amount); err != nil {
+				return err
+			}
+		}
+
+		refund.Status = models.RefundProcessing
+		refund.PaymentID = &payment.ID
+		return tx.Model(&models.Refund{}).
+			Where("id = ?", refund.ID).
+			Updates(map[string]interface{}{
+				"status":     refund.Status,
+				"payment_id": refund.PaymentID,
+				"updated_at": time.Now(),
+			}).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &refund, payment, nil
+}
+
+// StaleRefunds lists refunds that have been processing for longer than staleAfter
+func StaleRefunds(staleAfter time.Duration) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := config.DB.Model(&models.Refund{}).
+		Where("status = ? AND updated_at < ?", models.RefundProcessing, time.Now().Add(-staleAfter)).
+		Order("created_at").
+		Pluck("id", &ids).
+		Error
+	return ids, err
+}
+
+// CompleteRefund stores the provider's answer. On success the order's refunded total goes up,
+// returned items are restocked if asked, and a fully refunded order moves to refunded.
+func CompleteRefund(refundID uuid.UUID, actorID uuid.UUID, succeeded bool, providerRef string, failureReason string) (*models.Refund, error) {
+	var refund models.Refund
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("Items.OrderItem").
+			First(&refund, "id = ?", refundID).Error; err != nil {
+			return err
+		}
+		if refund.Status != models.RefundProcessing {
+			return ErrRefundNotPending
+		}
+
+		now := time.Now()
+		refund.Status = models.RefundFailed
+		if succeeded {
+			refund.Status = models.RefundSucceeded
+		}
+		refund.ProviderRef = providerRef
+		refund.FailureReason = failureReason
+		refund.ProcessedBy = &actorID
+		refund.ProcessedAt = &now
+
+		if err := tx.Model(&models.Refund{}).
+			Where("id = ?", refund.ID).
+			Updates(map[string]interface{}{
+				"status":         refund.Status,
+				"provider_ref":   refund.ProviderRef,
+				"failure_reason": refund.FailureReason,
+				"processed_by":   refund.ProcessedBy,
+				"processed_at":   refund.ProcessedAt,
+				"updated_at":     now,
+			}).Error; err != nil {
+			return err
+		}
+
+		if !succeeded {
+			return nil
+		}
+
+		order, err := GetOrderForUpdate(tx, refund.OrderID)
+		if err != nil {
+			return err
+		}
+		order.RefundedAmount = order.RefundedAmount.Add(refund.Amount)
+		if err := tx.Model(&models.Order{}).
+			Where("id = ?", order.ID).
+			Updates(map[string]interface{}{
+				"refunded_amount": order.RefundedAmount,
+				"updated_at":      now,
+			}).Error; err != nil {
+			return err
+		}
+
+		if refund.Restock {
+			// same product order as checkout, to avoid deadlocks
+			sort.Slice(refund.Items, func(i, j int) bool {
+				return refund.Items[i].OrderItem.ProductID.String() < refund.Items[j].OrderItem.ProductID.String()
+			})
+			for _, item := range refund.Items {
+				if err := RestoreStock(tx, item.OrderItem.ProductID, item.Quantity); err != nil {
+					return err
+				}
+			}
+		}
+
+		if order.RefundedAmount.GreaterThanOrEqual(order.TotalAmount) && order.Status.CanTransitionTo(models.OrderRefunded) {
+			return ChangeOrderStatus(tx, order, models.OrderRefunded, actorID, "fully refunded: "+refund.Reason)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &refund, nil
+}
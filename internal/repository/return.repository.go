@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/helper"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrOrderNotReturnable      = errors.New("order can't be returned")
+	ErrReturnWindowClosed      = errors.New("return window has closed")
+	ErrInvalidReturnItem       = errors.New("invalid return item")
+	ErrInvalidReturnTransition = errors.New("invalid return status transition")
+)
+
+// CreateReturnRequest opens an RMA for items of a delivered order.
+// Items must be returnable and the request has to come within window of delivery.
+func CreateReturnRequest(orderID uuid.UUID, userID uuid.UUID, reason string, items []helper.ReturnItemParams, window time.Duration) (*models.ReturnRequest, error) {
+	var rma models.ReturnRequest
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		order, err := GetOrderForUpdate(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.UserID != userID {
+			return gorm.ErrRecordNotFound
+		}
+		if order.Status != models.OrderDelivered {
+			return fmt.Errorf("%w: order is %s", ErrOrderNotReturnable, order.Status)
+		}
+
+		var delivered models.OrderStatusHistory
+		if err := tx.
+			Where("order_id = ? AND to_status = ?", order.ID, models.OrderDelivered).
+			Order("created_at DESC").
+			First(&delivered).Error; err != nil {
+			return err
+		}
+		if time.Since(delivered.CreatedAt) > window {
+			return ErrReturnWindowClosed
+		}
+
+		returnItems := make([]models.ReturnItem, 0, len(items))
+		for _, item := range items {
+			var orderItem models.OrderItem
+			if err := tx.Preload("Product", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+				First(&orderItem, "id = ? AND order_id = ?", item.OrderItemID, order.ID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return fmt.Errorf("%w: %s is not part of this order", ErrInvalidReturnItem, item.OrderItemID)
+				}
+				return err
+			}
+			if !orderItem.Product.IsReturnable {
+				return fmt.Errorf("%w: %s is not returnable", ErrInvalidReturnItem, orderItem.ProductName)
+			}
+
+			var alreadyRequested int
+			if err := tx.Table("return_items").
+				Joins("JOIN return_requests ON return_requests.id = return_items.return_request_id").
+				Where("return_items.order_item_id = ? AND return_requests.status NOT IN ?", orderItem.ID,
+					[]models.ReturnStatus{models.ReturnRejected, models.ReturnDeclined}).
+				Select("COALESCE(SUM(return_items.quantity), 0)").
+				Scan(&alreadyRequested).Error; err != nil {
+				return err
+			}
+			// the same item may be listed more than once in this request
+			for _, accepted := range returnItems {
+				if accepted.OrderItemID == orderItem.ID {
+					alreadyRequested += accepted.Quantity
+				}
+			}
+			if item.Quantity+alreadyRequested > orderItem.Quantity {
+				return fmt.Errorf("%w: only %d of %s can still be returned", ErrInvalidReturnItem, orderItem.Quantity-alreadyRequested, orderItem.ProductName)
+			}
+
+			returnItems = append(returnItems, models.ReturnItem{
+				OrderItemID: orderItem.ID,
+				Quantity:    item.Quantity,
+				Reason:      item.Reason,
+			})
+		}
+
+		rma = models.ReturnRequest{
+			OrderID: order.ID,
+			UserID:  userID,
+			Status:  models.ReturnRequested,
+			Reason:  reason,
+			Items:   returnItems,
+		}
+		if err := tx.Create(&rma).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.ReturnEvent{
+			ReturnRequestID: rma.ID,
+			ToStatus:        models.ReturnRequested,
+			ActorID:         userID,
+			Note:            reason,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &rma, nil
+}
+
+// TransitionReturn moves a return to the next step and records who did it.
+// refundID is stored when the step issued a refund.
+func TransitionReturn(returnID uuid.UUID, to models.ReturnStatus, actorID uuid.UUID, note string, refundID *uuid.UUID) (*models.ReturnRequest, error) {
+	var rma models.ReturnRequest
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&rma, "id = ?", returnID).Error; err != nil {
+			return err
+		}
+
+		from := rma.Status
+		if !from.CanTransitionTo(to) {
+			return fmt.Errorf("%w: %s -> %s", ErrInvalidReturnTransition, from, to)
+		}
+		if to == models.ReturnDeclined && rma.RefundID != nil {
+			// a passed inspection is already refunding it
+			var refund models.Refund
+			if err := tx.First(&refund, "id = ?", *rma.RefundID).Error; err != nil {
+				return err
+			}
+			if refund.Status != models.RefundFailed {
+				return fmt.Errorf("%w: return is being refunded", ErrInvalidReturnTransition)
+			}
+		}
+
+		updates := map[string]interface{}{
+			"status":     to,
+			"updated_at": time.Now(),
+		}
+		if refundID != nil {
+			updates["refund_id"] = *refundID
+		}
+		if err := tx.Model(&models.ReturnRequest{}).Where("id = ?", rma.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.ReturnEvent{
+			ReturnRequestID: rma.ID,
+			FromStatus:      &from,
+			ToStatus:        to,
+			ActorID:         actorID,
+			Note:            note,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetReturnByID(returnID)
+}
+
+// ClaimReturnRefund creates the refund for a received return and attaches it, under the return's lock.
+// A return gets at most one live refund: if it already has one that didn't fail, that refund is
+// returned instead, so a retried or concurrent inspection continues it rather than paying twice.
+// created tells whether the refund was made by this call.
+func ClaimReturnRefund(returnID uuid.UUID, actorID uuid.UUID) (refund *models.Refund, created bool, err error) {
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var rma models.ReturnRequest
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&rma, "id = ?", returnID).Error; err != nil {
+			return err
+		}
+		if !rma.Status.CanTransitionTo(models.ReturnCompleted) {
+			return fmt.Errorf("%w: %s -> %s", ErrInvalidReturnTransition, rma.Status, models.ReturnCompleted)
+		}
+
+		if rma.RefundID != nil {
+			refund = &models.Refund{}
+			if err := tx.First(refund, "id = ?", *rma.RefundID).Error; err != nil {
+				return err
+			}
+			if refund.Status != models.RefundFailed {
+				return nil
+			}
+		}
+
+		var items []models.ReturnItem
+		if err := tx.Where("return_request_id = ?", rma.ID).Find(&items).Error; err != nil {
+			return err
+		}
+		params := helper.RefundParams{
+			OrderID: rma.OrderID,
+			ActorID: actorID,
+			Reason:  "return " + rma.ID.String() + ": " + rma.Reason,
+			Restock: true,
+		}
+		for _, item := range items {
+			params.Items = append(params.Items, helper.RefundItemParams{
+				OrderItemID: item.OrderItemID,
+				Quantity:    item.Quantity,
+			})
+		}
+
+		var err error
+		if refund, err = createRefund(tx, params); err != nil {
+			return err
+		}
+		created = true
+
+		return tx.Model(&models.ReturnRequest{}).
+			Where("id = ?", rma.ID).
+			Updates(map[string]interface{}{
+				"refund_id":  refund.ID,
+				"updated_at": time.Now(),
+			}).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return refund, created, nil
+}
+
+func GetReturnByID(id uuid.UUID) (*models.ReturnRequest, error) {
+	var rma models.ReturnRequest
+	err := config.DB.
+		Preload("Items").
+		Preload("Events", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC") }).
+		First(&rma, "id = ?", id).
+		Error
+	return &rma, err
+}
+
+func GetReturnsByOrder(orderID uuid.UUID) ([]models.ReturnRequest, error) {
+	var returns []models.ReturnRequest
+	err := config.DB.
+		Preload("Items").
+		Where("order_id = ?", orderID).
+		Order("created_at DESC").
+		Find(&returns).
+		Error
+	return returns, err
+}
+
+func ListReturns(status string, page int, limit int) ([]models.ReturnRequest, int64, error) {
+	var returns []models.ReturnRequest
+	var total int64
+
+	query := config.DB.Model(&models.ReturnRequest{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.
+		Preload("Items").
+		Order("created_at DESC").
+		Limit(limit).
+		Offset((page - 1) * limit).
+		Find(&returns).
+		Error
+	return returns, total, err
+}
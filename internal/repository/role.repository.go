@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"errors"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrUnknownRole = errors.New("unknown role")
+
+// SeedRolesAndPermissions makes sure the default roles and their permissions exist.
+// Permissions added to models.DefaultRolePermissions later are picked up on the next start.
+func SeedRolesAndPermissions() error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		for roleName, permNames := range models.DefaultRolePermissions {
+			role := models.Role{Name: roleName}
+			if err := tx.Where(models.Role{Name: roleName}).FirstOrCreate(&role).Error; err != nil {
+				return err
+			}
+
+			for _, permName := range permNames {
+				perm := models.Permission{Name: permName}
+				if err := tx.Where(models.Permission{Name: permName}).FirstOrCreate(&perm).Error; err != nil {
+					return err
+				}
+				if err := tx.Exec(
+					"INSERT INTO role_permissions (role_id, permission_id) VALUES (?, ?) ON CONFLICT DO NOTHING",
+					role.ID, perm.ID,
+				).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// BootstrapAdmin gives the admin role to the user with this email, but only while
+// nobody is admin yet. Afterwards admins are managed through the API.
+func BootstrapAdmin(email string) error {
+	var admins int64
+	if err := config.DB.Table("user_roles").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("roles.name = ?", models.RoleAdmin).
+		Count(&admins).Error; err != nil {
+		return err
+	}
+	if admins > 0 {
+		return nil
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, "email = ?", email).Error; err != nil {
+		return err
+	}
+
+	if err := AssignRole(user.ID, models.RoleAdmin, nil); err != nil {
+		return err
+	}
+	log.Printf("Bootstrapped %s as the first admin", email)
+	return nil
+}
+
+func GetRoles() ([]models.Role, error) {
+	var roles []models.Role
+	err := config.DB.Preload("Permissions").Order("name").Find(&roles).Error
+	return roles, err
+}
+
+func GetRoleByName(name string) (*models.Role, error) {
+	var role models.Role
+	err := config.DB.First(&role, "name = ?", name).Error
+	return &role, err
+}
+
+func AssignRole(userID uuid.UUID, roleName string, assignedBy *uuid.UUID) error {
+	role, err := GetRoleByName(roleName)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUnknownRole
+		}
+		return err
+	}
+
+	return config.DB.
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.UserRole{
+			UserID:     userID,
+			RoleID:     role.ID,
+			AssignedBy: assignedBy,
+		}).Error
+}
+
+func RevokeRole(userID uuid.UUID, roleName string) error {
+	role, err := GetRoleByName(roleName)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUnknownRole
+		}
+		return err
+	}
+
+	return config.DB.
+		Where("user_id = ? AND role_id = ?", userID, role.ID).
+		Delete(&models.UserRole{}).
+		Error
+}
+
+func GetUserRoles(userID uuid.UUID) ([]models.UserRole, error) {
+	var userRoles []models.UserRole
+	err := config.DB.
+		Preload("Role.Permissions").
+		Where("user_id = ?", userID).
+		Find(&userRoles).
+		Error
+	return userRoles, err
+}
+
+// GetUserRoleNames is what goes into the JWT roles claim
+func GetUserRoleNames(userID uuid.UUID) ([]string, error) {
+	var names []string
+	err := config.DB.Table("user_roles").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.name").
+		Pluck("roles.name", &names).
+		Error
+	return names, err
+}
+
+// UserHasPermission is checked on every request so revoking a role takes effect immediately
+func UserHasPermission(userID uuid.UUID, permission string) (bool, error) {
+	var count int64
+	err := config.DB.Table("user_roles").
+		Joins("JOIN role_permissions ON role_permissions.role_id = user_roles.role_id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("user_roles.user_id = ? AND permissions.name = ?", userID, permission).
+		Count(&count).
+		Error
+	return count > 0, err
+}
+
+// GetUserPermissionNames lists every permission granted by the user's roles
+func GetUserPermissionNames(userID uuid.UUID) ([]string, error) {
+	var names []string
+	err := config.DB.Table("user_roles").
+		Joins("JOIN role_permissions ON role_permissions.role_id = user_roles.role_id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("user_roles.user_id = ?", userID).
+		Distinct().
+		Order("permissions.name").
+		Pluck("permissions.name", &names).
+		Error
+	return names, err
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrTOTPCodeReused       = errors.New("this code was already used")
+	ErrInvalidRecoveryCode  = errors.New("invalid recovery code")
+	ErrTwoFactorNotEnrolled = errors.New("start two-factor enrollment first")
+)
+
+func GetUserTOTP(userID uuid.UUID) (*models.UserTOTP, error) {
+	var totp models.UserTOTP
+	err := config.DB.First(&totp, "user_id = ?", userID).Error
+	return &totp, err
+}
+
+// IsTwoFactorEnabled reports whether the user has a confirmed authenticator
+func IsTwoFactorEnabled(userID uuid.UUID) (bool, error) {
+	var count int64
+	err := config.DB.Model(&models.UserTOTP{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL", userID).
+		Count(&count).
+		Error
+	return count > 0, err
+}
+
+// SaveUnconfirmedTOTP starts (or restarts) enrollment with a new secret.
+// A confirmed authenticator has to be disabled before a new one can be enrolled.
+func SaveUnconfirmedTOTP(userID uuid.UUID, secretEncrypted string) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var existing models.UserTOTP
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&existing, "user_id = ?", userID).Error
+		if err == nil {
+			if existing.Enabled() {
+				return ErrTwoFactorEnabled
+			}
+			return tx.Model(&models.UserTOTP{}).
+				Where("user_id = ?", userID).
+				Updates(map[string]interface{}{
+					"secret_encrypted": secretEncrypted,
+					"last_used_step":   0,
+					"updated_at":       time.Now(),
+				}).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return tx.Create(&models.UserTOTP{UserID: userID, SecretEncrypted: secretEncrypted}).Error
+	})
+}
+
+// ConfirmTOTP enables 2FA after the first valid code and stores the recovery codes
+func ConfirmTOTP(userID uuid.UUID, step int64, recoveryCodeHashes []string) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var totp models.UserTOTP
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&totp, "user_id = ?", userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTwoFactorNotEnrolled
+			}
+			return err
+		}
+		if totp.Enabled() {
+			return ErrTwoFactorEnabled
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.UserTOTP{}).
+			Where("user_id = ?", userID).
+			Updates(map[string]interface{}{
+				"confirmed_at":   now,
+				"last_used_step": step,
+				"updated_at":     now,
+			}).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userID, recoveryCodeHashes)
+	})
+}
+
+// UseTOTPStep records that the code of this time step was used. Steps only move forward,
+// so a code that was already accepted once (or an older one) is rejected.
+func UseTOTPStep(userID uuid.UUID, step int64) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var totp models.UserTOTP
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&totp, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		if !totp.Enabled() {
+			return ErrTwoFactorNotEnabled
+		}
+		if step <= totp.LastUsedStep {
+			return ErrTOTPCodeReused
+		}
+		return tx.Model(&models.UserTOTP{}).
+			Where("user_id = ?", userID).
+			Updates(map[string]interface{}{
+				"last_used_step": step,
+				"updated_at":     time.Now(),
+			}).Error
+	})
+}
+
+// UseRecoveryCode burns one unused recovery code
+func UseRecoveryCode(userID uuid.UUID, codeHash string) error {
+	result := config.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidRecoveryCode
+	}
+	return nil
+}
+
+func CountUnusedRecoveryCodes(userID uuid.UUID) (int64, error) {
+	var count int64
+	err := config.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).
+		Error
+	return count, err
+}
+
+// ReplaceRecoveryCodes invalidates every old recovery code
+func ReplaceRecoveryCodes(userID uuid.UUID, codeHashes []string) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]models.RecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, models.RecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
+
+// DisableTOTP removes the authenticator and all recovery codes
+func DisableTOTP(userID uuid.UUID) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		return disableTOTP(tx, userID)
+	})
+}
+
+func disableTOTP(tx *gorm.DB, userID uuid.UUID) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&models.UserTOTP{}).Error
+}
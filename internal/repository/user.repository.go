@@ -1,10 +1,22 @@
 package repository
 
 import (
+	"errors"
+	"strings"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/helper"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrAccountSuspended   = errors.New("account is suspended")
+	ErrUserNotSuspended   = errors.New("account is not suspended")
+	ErrAccountUnavailable = errors.New("account no longer exists")
 )
 
 func Login() {}
@@ -26,12 +38,21 @@ func GetUserByUUID(id uuid.UUID) (*models.User, error) {
 
 func GetUserByEmail(email string) (*models.User, error) {
 	var user models.User
-	if err := config.DB.Select("id", "username", "email", "created_at").First(&user, "email = ?", email).Error; err != nil {
+	if err := config.DB.Select("id", "fullname", "username", "email", "password", "email_verified_at", "avatar_url", "suspended_at", "password_reset_required", "created_at").First(&user, "email = ?", email).Error; err != nil {
 		return nil, err // GORM returns gorm.ErrRecordNotFound if no match
 	}
 	return &user, nil
 }
 
+// FindUserByEmailFold matches the email case-insensitively, for addresses reported by other systems
+func FindUserByEmailFold(email string) (*models.User, error) {
+	var user models.User
+	if err := config.DB.First(&user, "LOWER(email) = LOWER(?)", email).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 func GetAllUsers() ([]models.User, error) {
 	var users []models.User
 
@@ -45,32 +66,227 @@ func GetAllUsers() ([]models.User, error) {
 	return users, nil
 }
 
+// FilterAndSearchUsers is the admin user search. Name matches the full name or username,
+// Product matches users who ordered a product with that name.
 func FilterAndSearchUsers(params helper.UserFilterParams) (*[]models.User, int64, error) {
 	var users []models.User
 	var total int64
 	offset := (params.Page - 1) * params.Limit
 	query := config.DB.Model(&models.User{})
-	if params.FullName != "" {
-		query = query.Where("fullname ILIKE ?", "%"+params.FullName+"%")
+	if params.Name != "" {
+		query = query.Where("fullname ILIKE ? OR username ILIKE ?", "%"+params.Name+"%", "%"+params.Name+"%")
+	}
+	if params.Email != "" {
+		query = query.Where("email ILIKE ?", "%"+params.Email+"%")
+	}
+	switch params.Status {
+	case helper.UserStatusActive:
+		query = query.Where("suspended_at IS NULL")
+	case helper.UserStatusSuspended:
+		query = query.Where("suspended_at IS NOT NULL")
 	}
 
-	// 3. Filter by Product Name (Joined via Orders -> OrderItems -> Products)
+	// Path: Users -> Orders -> OrderItems -> Products. A subquery keeps one row per user.
 	if params.ProductName != "" {
-		// Path: Users -> Orders -> OrderItems -> Products
-		query = query.Joins("JOIN orders ON orders.user_id = users.id").
+		purchased := config.DB.Table("orders").
+			Select("orders.user_id").
 			Joins("JOIN order_items ON order_items.order_id = orders.id").
 			Joins("JOIN products ON order_items.product_id = products.id").
-			Where("products.product_name ILIKE ?", "%"+params.ProductName+"%").
-			Group("users.id")
+			Where("products.name ILIKE ?", "%"+params.ProductName+"%")
+		query = query.Where("users.id IN (?)", purchased)
 	}
 
-	if err := config.DB.Table("(?) as sub", query).Count(&total).Error; err != nil {
+	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
-	err := query.Limit(params.Limit).
+	err := query.
+		Order("created_at DESC").
+		Limit(params.Limit).
 		Offset(offset).
-		Preload("Orders.OrderItems.Product").
 		Find(&users).Error
 
 	return &users, total, err
 }
+
+// UpdatePassword stores a new password hash and revokes every refresh token of the user
+// in the same transaction, so no session outlives the old password.
+func UpdatePassword(userID uuid.UUID, hashedPassword string) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		return updatePassword(tx, userID, hashedPassword)
+	})
+}
+
+func updatePassword(tx *gorm.DB, userID uuid.UUID, hashedPassword string) error {
+	if err := tx.Model(&models.User{}).
+		Where("id = ?", userID).
+		Updates(map[string]interface{}{
+			"password":                hashedPassword,
+			"password_reset_required": false,
+			"updated_at":              time.Now(),
+		}).Error; err != nil {
+		return err
+	}
+	// keys were handed out under the old password, whoever knew it may have made some
+	if err := revokeAPIKeys(tx, userID); err != nil {
+		return err
+	}
+	return revokeRefreshTokens(tx.Where("user_id = ?", userID), time.Now())
+}
+
+// UpdateUserProfile applies the changed profile fields. A new email address starts out
+// unverified; previousEmail is set when the address changed so the caller can notify it.
+func UpdateUserProfile(userID uuid.UUID, params helper.ProfileUpdateParams) (user *models.User, previousEmail string, err error) {
+	user = &models.User{}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(user, "id = ?", userID).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{}
+		if params.Fullname != nil && *params.Fullname != user.Fullname {
+			updates["fullname"] = *params.Fullname
+			user.Fullname = *params.Fullname
+		}
+		if params.Username != nil && *params.Username != user.Username {
+			updates["username"] = *params.Username
+			user.Username = *params.Username
+		}
+		if params.Email != nil && *params.Email != user.Email {
+			// fixing the letter case keeps the address verified
+			if !strings.EqualFold(*params.Email, user.Email) {
+				previousEmail = user.Email
+				updates["email_verified_at"] = nil
+				user.EmailVerifiedAt = nil
+			}
+			updates["email"] = *params.Email
+			user.Email = *params.Email
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+
+		updates["updated_at"] = time.Now()
+		return tx.Model(&models.User{}).Where("id = ?", userID).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return user, previousEmail, nil
+}
+
+// SetAvatarURL stores the new avatar and returns the previous one so the caller can delete the file
+func SetAvatarURL(userID uuid.UUID, url string) (string, error) {
+	var previous string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "avatar_url").
+			First(&user, "id = ?", userID).Error; err != nil {
+			return err
+		}
+		previous = user.AvatarURL
+		return tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			Updates(map[string]interface{}{
+				"avatar_url": url,
+				"updated_at": time.Now(),
+			}).Error
+	})
+	return previous, err
+}
+
+// CheckAccountActive is run on every authenticated request. It returns ErrAccountSuspended
+// or ErrAccountUnavailable for erased and deleted accounts.
+func CheckAccountActive(userID uuid.UUID) error {
+	var user models.User
+	err := config.DB.Select("id", "suspended_at").First(&user, "id = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrAccountUnavailable
+	}
+	if err != nil {
+		return err
+	}
+	if user.SuspendedAt != nil {
+		return ErrAccountSuspended
+	}
+	return nil
+}
+
+// SuspendUser blocks the account and ends its sessions. Suspending again only updates the reason.
+func SuspendUser(userID uuid.UUID, reason string) (*models.User, error) {
+	var user models.User
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id = ?", userID).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if user.SuspendedAt == nil {
+			user.SuspendedAt = &now
+		}
+		user.SuspendedReason = reason
+		if err := tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			Updates(map[string]interface{}{
+				"suspended_at":     user.SuspendedAt,
+				"suspended_reason": reason,
+				"updated_at":       now,
+			}).Error; err != nil {
+			return err
+		}
+		return revokeRefreshTokens(tx.Where("user_id = ?", userID), now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func ReactivateUser(userID uuid.UUID) (*models.User, error) {
+	var user models.User
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id = ?", userID).Error; err != nil {
+			return err
+		}
+		if user.SuspendedAt == nil {
+			return ErrUserNotSuspended
+		}
+
+		user.SuspendedAt = nil
+		user.SuspendedReason = ""
+		return tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			Updates(map[string]interface{}{
+				"suspended_at":     nil,
+				"suspended_reason": "",
+				"updated_at":       time.Now(),
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// RequirePasswordReset stops the current password from working, ends every session and revokes
+// the API keys, until the user sets a new password (which clears the flag, see updatePassword)
+func RequirePasswordReset(userID uuid.UUID) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			Updates(map[string]interface{}{
+				"password_reset_required": true,
+				"updated_at":              time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := revokeAPIKeys(tx, userID); err != nil {
+			return err
+		}
+		return revokeRefreshTokens(tx.Where("user_id = ?", userID), time.Now())
+	})
+}
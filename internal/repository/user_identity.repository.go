@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrAccountAlreadyVerified means the email got verified in the meantime, link it the normal way
+var ErrAccountAlreadyVerified = errors.New("account email is already verified")
+
+// GetUserByIdentity finds the user linked to this provider account
+func GetUserByIdentity(provider string, subject string) (*models.User, error) {
+	var identity models.UserIdentity
+	if err := config.DB.
+		Preload("User").
+		First(&identity, "provider = ? AND subject = ?", provider, subject).Error; err != nil {
+		return nil, err
+	}
+	// a soft deleted user is not preloaded
+	if identity.User.ID == uuid.Nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	now := time.Now()
+	config.DB.Model(&models.UserIdentity{}).Where("id = ?", identity.ID).Update("last_login_at", now)
+	return &identity.User, nil
+}
+
+// LinkIdentity attaches a provider account to an existing user
+func LinkIdentity(userID uuid.UUID, provider string, subject string, email string) error {
+	now := time.Now()
+	return config.DB.Create(&models.UserIdentity{
+		UserID:      userID,
+		Provider:    provider,
+		Subject:     subject,
+		Email:       email,
+		LastLoginAt: &now,
+	}).Error
+}
+
+// ClaimAccountWithIdentity links a provider account to a user whose own email was never verified.
+// The provider proved the address belongs to whoever is signing in now, so anyone who registered
+// it before loses access: the password is replaced, two-factor is removed, and refresh tokens
+// and API keys are revoked. Access tokens are the caller's job, they live in Redis.
+func ClaimAccountWithIdentity(userID uuid.UUID, hashedPassword string, provider string, subject string, email string) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id = ?", userID).Error; err != nil {
+			return err
+		}
+		if user.EmailVerifiedAt != nil {
+			return ErrAccountAlreadyVerified
+		}
+
+		if err := updatePassword(tx, userID, hashedPassword); err != nil {
+			return err
+		}
+		if err := disableTOTP(tx, userID); err != nil {
+			return err
+		}
+		// other identities may have been linked by the same person
+		if err := tx.Where("user_id = ?", userID).Delete(&models.UserIdentity{}).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("email_verified_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UserIdentity{
+			UserID:      userID,
+			Provider:    provider,
+			Subject:     subject,
+			Email:       email,
+			LastLoginAt: &now,
+		}).Error
+	})
+}
+
+// CreateUserWithIdentity registers a new user who signed up through a provider
+func CreateUserWithIdentity(user *models.User, provider string, subject string) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		return tx.Create(&models.UserIdentity{
+			UserID:      user.ID,
+			Provider:    provider,
+			Subject:     subject,
+			Email:       user.Email,
+			LastLoginAt: &now,
+		}).Error
+	})
+}
+
+// UsernameTaken also counts soft deleted users, the unique index still covers them
+func UsernameTaken(username string) (bool, error) {
+	var count int64
+	err := config.DB.Unscoped().Model(&models.User{}).Where("username = ?", username).Count(&count).Error
+	return count > 0, err
+}
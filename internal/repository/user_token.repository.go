@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrUserTokenInvalid     = errors.New("token is invalid or has expired")
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+)
+
+// CreateUserToken stores a new token and voids the unused ones of the same purpose,
+// so only the most recent mail works
+func CreateUserToken(userID uuid.UUID, purpose models.UserTokenPurpose, email string, tokenHash string, ttl time.Duration) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UserToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: tokenHash,
+			Email:     email,
+			ExpiresAt: now.Add(ttl),
+		}).Error
+	})
+}
+
+// consumeUserToken marks the token used inside tx. Anything unknown, used, expired
+// or meant for another purpose is ErrUserTokenInvalid.
+func consumeUserToken(tx *gorm.DB, purpose models.UserTokenPurpose, tokenHash string) (*models.UserToken, error) {
+	var token models.UserToken
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&token, "token_hash = ? AND purpose = ?", tokenHash, purpose).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserTokenInvalid
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if token.UsedAt != nil || now.After(token.ExpiresAt) {
+		return nil, ErrUserTokenInvalid
+	}
+	if err := tx.Model(&models.UserToken{}).Where("id = ?", token.ID).Update("used_at", now).Error; err != nil {
+		return nil, err
+	}
+	token.UsedAt = &now
+	return &token, nil
+}
+
+// ResetPassword redeems a password reset token and sets the new password in one transaction
+func ResetPassword(tokenHash string, hashedPassword string) (uuid.UUID, error) {
+	var userID uuid.UUID
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeUserToken(tx, models.TokenPasswordReset, tokenHash)
+		if err != nil {
+			return err
+		}
+		userID = token.UserID
+		return updatePassword(tx, userID, hashedPassword)
+	})
+	return userID, err
+}
+
+// VerifyEmail redeems an email verification token. A token sent to an address the user
+// has since changed away from is rejected.
+func VerifyEmail(tokenHash string) (*models.User, error) {
+	var user models.User
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeUserToken(tx, models.TokenEmailVerification, tokenHash)
+		if err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id = ?", token.UserID).Error; err != nil {
+			return err
+		}
+		if user.Email != token.Email {
+			return ErrUserTokenInvalid
+		}
+		if user.EmailVerifiedAt != nil {
+			return nil
+		}
+
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).Update("email_verified_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -1,13 +1,19 @@
 package routes
 
 import (
+	"path"
+
 	"github.com/gin-gonic/gin"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/handlers"
 	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/middleware"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/models"
 )
 
 func SetRoutes(r *gin.Engine) {
 
+	// public keys for other services verifying our tokens
+	r.GET("/.well-known/jwks.json", handlers.JWKS)
+
 	// API v1 prefix for all routes
 	api := r.Group("/api/v1")
 
@@ -18,9 +24,49 @@ func SetRoutes(r *gin.Engine) {
 		// ✅ Simple pattern: validation happens inside handler via ShouldBindJSON
 		user.POST("/register", handlers.Register)
 		user.POST("/login", handlers.Login)
-		user.GET("/all", middleware.AuthMiddleware(), handlers.GetAllUsers)
-		user.GET("/user/:id", middleware.AuthMiddleware(), handlers.GetUser)
-		user.GET("/user", middleware.AuthMiddleware(), handlers.GetUserByEmail)
+		user.POST("/login/2fa", handlers.LoginTwoFactor)
+		user.POST("/token/refresh", handlers.RefreshToken)
+		user.POST("/password/reset", handlers.RequestPasswordReset)
+		user.POST("/password/reset/confirm", handlers.ConfirmPasswordReset)
+		user.POST("/email/verify", handlers.VerifyEmail)
+		user.POST("/email/verify/resend", middleware.AuthMiddleware(), handlers.ResendVerificationEmail)
+		user.POST("/2fa/enroll", middleware.AuthMiddleware(), handlers.EnrollTwoFactor)
+		user.POST("/2fa/verify", middleware.AuthMiddleware(), handlers.ConfirmTwoFactor)
+		user.POST("/2fa/recovery-codes", middleware.AuthMiddleware(), handlers.RegenerateRecoveryCodes)
+		user.POST("/2fa/disable", middleware.AuthMiddleware(), handlers.DisableTwoFactor)
+		user.GET("/api-keys", middleware.AuthMiddleware(), handlers.ListAPIKeys)
+		user.POST("/api-keys", middleware.AuthMiddleware(), handlers.CreateAPIKey)
+		user.DELETE("/api-keys/:id", middleware.AuthMiddleware(), handlers.RevokeAPIKey)
+		user.POST("/logout", middleware.AuthMiddleware(), handlers.Logout)
+		user.POST("/logout/all", middleware.AuthMiddleware(), handlers.LogoutAll)
+		user.GET("/me", middleware.AuthMiddleware(), handlers.GetMe)
+		user.PATCH("/me", middleware.AuthMiddleware(), handlers.UpdateMe)
+		user.POST("/me/password", middleware.AuthMiddleware(), handlers.ChangePassword)
+		user.PUT("/me/avatar", middleware.AuthMiddleware(), handlers.UploadAvatar)
+		user.DELETE("/me", middleware.AuthMiddleware(), handlers.EraseMe)
+		user.GET("/me/exports", middleware.AuthMiddleware(), handlers.ListDataExports)
+		user.POST("/me/exports", middleware.AuthMiddleware(), handlers.RequestDataExport)
+		user.GET("/me/exports/:id", middleware.AuthMiddleware(), handlers.GetDataExport)
+		user.GET("/me/exports/:id/download", middleware.AuthMiddleware(), handlers.DownloadDataExport)
+		user.GET("/me/addresses", middleware.AuthMiddleware(), handlers.ListAddresses)
+		user.POST("/me/addresses", middleware.AuthMiddleware(), handlers.CreateAddress)
+		user.GET("/me/addresses/:id", middleware.AuthMiddleware(), handlers.GetAddress)
+		user.PUT("/me/addresses/:id", middleware.AuthMiddleware(), handlers.UpdateAddress)
+		user.DELETE("/me/addresses/:id", middleware.AuthMiddleware(), handlers.DeleteAddress)
+
+		userAdmin := user.Group("")
+		userAdmin.Use(middleware.AuthMiddleware())
+		permit(userAdmin, "GET", "/all", models.PermUserManage, handlers.GetAllUsers)
+		permit(userAdmin, "GET", "/user/:id", models.PermUserManage, handlers.GetUser)
+		permit(userAdmin, "GET", "/user", models.PermUserManage, handlers.GetUserByEmail)
+	}
+
+	// sign in with external identity providers
+
+	auth := api.Group("/auth")
+	{
+		auth.GET("/oidc/:provider/login", handlers.OIDCLogin)
+		auth.GET("/oidc/:provider/callback", handlers.OIDCCallback)
 	}
 
 	// product routes
@@ -33,9 +79,9 @@ func SetRoutes(r *gin.Engine) {
 		productProtected.Use(middleware.AuthMiddleware())
 		{
 			productProtected.GET("/:id", handlers.GetProductById)
-			productProtected.POST("/", handlers.CreateNewProduct)
-			productProtected.PUT("/:id", handlers.UpdateProduct)
-			productProtected.DELETE("/:id", handlers.DeleteProduct)
+			permit(productProtected, "POST", "/", models.PermProductWrite, middleware.IdempotencyMiddleware(), handlers.CreateNewProduct)
+			permit(productProtected, "PUT", "/:id", models.PermProductWrite, handlers.UpdateProduct)
+			permit(productProtected, "DELETE", "/:id", models.PermProductWrite, handlers.DeleteProduct)
 		}
 	}
 
@@ -46,14 +92,95 @@ func SetRoutes(r *gin.Engine) {
 	cartUserProtected.Use(middleware.AuthMiddleware())
 	{
 		cartUserProtected.GET("/items", handlers.GetAllCartItems)
-		cartUserProtected.POST("/item", handlers.AddOrUpdateCartItem)
+		cartUserProtected.POST("/item", middleware.IdempotencyMiddleware(), handlers.AddOrUpdateCartItem)
 	}
 
 	// Admin routes (admin authorized routes)
 	cartAdminProtected := cart.Group("/")
-	cartAdminProtected.Use(middleware.AuthMiddleware(), middleware.IsAuthorized("Admin"))
+	cartAdminProtected.Use(middleware.AuthMiddleware())
+	{
+		permit(cartAdminProtected, "GET", "/:userId", models.PermCartAdmin, handlers.GetCart)
+		permit(cartAdminProtected, "DELETE", "/:userId", models.PermCartAdmin, handlers.DeleteCart)
+	}
+
+	// order routes
+
+	api.POST("/checkout", middleware.AuthMiddleware(), middleware.RequireVerifiedEmail(), middleware.IdempotencyMiddleware(), handlers.Checkout)
+
+	order := api.Group("/orders")
+	order.Use(middleware.AuthMiddleware())
 	{
-		cartAdminProtected.GET("/:userId", handlers.GetCart)
-		cartAdminProtected.DELETE("/:userId", handlers.DeleteCart)
+		order.GET("", handlers.GetMyOrders)
+		order.GET("/:id", handlers.GetOrder)
+		order.POST("/:id/cancel", handlers.CancelOrder)
+		order.POST("/:id/payments", middleware.IdempotencyMiddleware(), handlers.StartPayment)
+		order.GET("/:id/returns", handlers.GetOrderReturns)
+		order.POST("/:id/returns", middleware.IdempotencyMiddleware(), handlers.RequestReturn)
+	}
+
+	api.GET("/returns/:id", middleware.AuthMiddleware(), handlers.GetReturn)
+
+	// payment routes
+
+	api.GET("/payments/:id", middleware.AuthMiddleware(), handlers.GetPayment)
+	// signed by the provider, no user auth
+	api.POST("/payments/webhooks/:provider", handlers.PaymentWebhook)
+
+	// admin routes
+
+	// each admin route requires its own permission, see models.DefaultRolePermissions
+	admin := api.Group("/admin")
+	admin.Use(middleware.AuthMiddleware())
+	{
+		permit(admin, "PATCH", "/orders/:id/status", models.PermOrderManage, handlers.UpdateOrderStatus)
+		permit(admin, "GET", "/orders/:id/history", models.PermOrderManage, handlers.GetOrderStatusHistory)
+
+		permit(admin, "GET", "/orders/:id/refunds", models.PermOrderRefund, handlers.GetOrderRefunds)
+		permit(admin, "POST", "/orders/:id/refunds", models.PermOrderRefund, middleware.IdempotencyMiddleware(), handlers.CreateRefund)
+		permit(admin, "POST", "/refunds/:id/process", models.PermOrderRefund, handlers.ProcessRefund)
+
+		permit(admin, "GET", "/returns", models.PermReturnManage, handlers.ListReturns)
+		permit(admin, "POST", "/returns/:id/approve", models.PermReturnManage, handlers.ApproveReturn)
+		permit(admin, "POST", "/returns/:id/reject", models.PermReturnManage, handlers.RejectReturn)
+		permit(admin, "POST", "/returns/:id/receive", models.PermReturnManage, handlers.ReceiveReturn)
+		permit(admin, "POST", "/returns/:id/inspect", models.PermReturnManage, middleware.RequirePermission(models.PermOrderRefund), handlers.InspectReturn)
+
+		permit(admin, "GET", "/payments/webhooks", models.PermPaymentManage, handlers.ListWebhookEvents)
+		permit(admin, "POST", "/payments/webhooks/:id/reprocess", models.PermPaymentManage, handlers.ReprocessWebhookEvent)
+
+		permit(admin, "GET", "/roles", models.PermRoleManage, handlers.GetRoles)
+		permit(admin, "GET", "/users/:id/roles", models.PermRoleManage, handlers.GetUserRoles)
+		permit(admin, "POST", "/users/:id/roles", models.PermRoleManage, handlers.AssignUserRole)
+		permit(admin, "DELETE", "/users/:id/roles/:role", models.PermRoleManage, handlers.RevokeUserRole)
+
+		permit(admin, "GET", "/users", models.PermUserManage, handlers.GetFilterAndSearchUsers)
+		permit(admin, "POST", "/users/:id/unlock", models.PermUserManage, handlers.UnlockUser)
+		permit(admin, "POST", "/users/:id/suspend", models.PermUserManage, handlers.SuspendUser)
+		permit(admin, "POST", "/users/:id/reactivate", models.PermUserManage, handlers.ReactivateUser)
+		permit(admin, "POST", "/users/:id/password-reset", models.PermUserManage, handlers.ForcePasswordReset)
+		permit(admin, "POST", "/users/:id/impersonate", models.PermUserImpersonate, handlers.ImpersonateUser)
+		permit(admin, "POST", "/users/:id/erase", models.PermUserManage, handlers.EraseUser)
+
+		permit(admin, "GET", "/audit-logs", models.PermAuditRead, handlers.ListAuditLogs)
+		permit(admin, "GET", "/audit-logs/export", models.PermAuditRead, handlers.ExportAuditLogs)
+	}
+}
+
+// permit registers a route behind RequirePermission and records its scope with the middleware,
+// API keys are only accepted on routes recorded this way (see middleware.DeclareScope).
+func permit(g *gin.RouterGroup, method string, relativePath string, permission string, handlers ...gin.HandlerFunc) {
+	middleware.DeclareScope(method, joinPath(g.BasePath(), relativePath), permission)
+	g.Handle(method, relativePath, append([]gin.HandlerFunc{middleware.RequirePermission(permission)}, handlers...)...)
+}
+
+// joinPath builds the full path the way gin does, so it matches c.FullPath()
+func joinPath(base string, relativePath string) string {
+	if relativePath == "" {
+		return base
+	}
+	joined := path.Join(base, relativePath)
+	if relativePath[len(relativePath)-1] == '/' && joined[len(joined)-1] != '/' {
+		return joined + "/"
 	}
+	return joined
 }
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+)
+
+const (
+	LocalBackendName = "local"
+	// LocalURLPrefix is where the API serves the local upload dir, see cmd/api
+	LocalURLPrefix = "/uploads/"
+)
+
+// LocalBackend writes files under STORAGE_LOCAL_DIR ("uploads" when unset), for development
+type LocalBackend struct {
+	Dir string
+}
+
+func NewLocalBackend() *LocalBackend {
+	return &LocalBackend{}
+}
+
+func (b *LocalBackend) Name() string { return LocalBackendName }
+
+// Root is the directory files are written to
+func (b *LocalBackend) Root() string {
+	if b.Dir != "" {
+		return b.Dir
+	}
+	if dir := config.LoadEnv().StorageLocalDir; dir != "" {
+		return dir
+	}
+	return "uploads"
+}
+
+func (b *LocalBackend) Put(ctx context.Context, key string, body io.Reader, contentType string) (string, error) {
+	path := filepath.Join(b.Root(), filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, body); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return LocalURLPrefix + key, nil
+}
+
+func (b *LocalBackend) Delete(ctx context.Context, url string) error {
+	if !strings.HasPrefix(url, LocalURLPrefix) {
+		return nil
+	}
+	key := strings.TrimPrefix(url, LocalURLPrefix)
+	// keys are generated by us, but never follow one out of the upload dir
+	if strings.Contains(key, "..") {
+		return nil
+	}
+	err := os.Remove(filepath.Join(b.Root(), filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+)
+
+const S3BackendName = "s3"
+
+// S3Backend uploads to S3_BUCKET with the default AWS credential chain.
+// S3_PUBLIC_URL is the base URL objects are served from (bucket URL or a CDN).
+type S3Backend struct{}
+
+func (b *S3Backend) Name() string { return S3BackendName }
+
+func (b *S3Backend) settings() (string, string, error) {
+	env := config.LoadEnv()
+	if env.S3Bucket == "" {
+		return "", "", errors.New("S3_BUCKET is not set")
+	}
+	publicURL := strings.TrimSuffix(env.S3PublicURL, "/")
+	if publicURL == "" {
+		publicURL = "https://" + env.S3Bucket + ".s3.amazonaws.com"
+	}
+	return env.S3Bucket, publicURL, nil
+}
+
+func (b *S3Backend) client(ctx context.Context) (*s3.Client, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s3.NewFromConfig(cfg), nil
+}
+
+func (b *S3Backend) Put(ctx context.Context, key string, body io.Reader, contentType string) (string, error) {
+	bucket, publicURL, err := b.settings()
+	if err != nil {
+		return "", err
+	}
+	client, err := b.client(ctx)
+	if err != nil {
+		return "", err
+	}
+	if _, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+	}); err != nil {
+		return "", err
+	}
+	return publicURL + "/" + key, nil
+}
+
+func (b *S3Backend) Delete(ctx context.Context, url string) error {
+	bucket, publicURL, err := b.settings()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(url, publicURL+"/") {
+		return nil
+	}
+	client, err := b.client(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(strings.TrimPrefix(url, publicURL+"/")),
+	})
+	return err
+}
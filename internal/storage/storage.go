@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+)
+
+var ErrUnknownBackend = errors.New("unknown storage backend")
+
+// Backend stores uploaded files and returns a public URL for them
+type Backend interface {
+	Name() string
+	Put(ctx context.Context, key string, body io.Reader, contentType string) (string, error)
+	// Delete takes a URL returned by Put; URLs the backend didn't create are ignored
+	Delete(ctx context.Context, url string) error
+}
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]Backend{}
+)
+
+func Register(b Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[b.Name()] = b
+}
+
+func Get(name string) (Backend, error) {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	b, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownBackend, name)
+	}
+	return b, nil
+}
+
+// Default returns the backend configured by STORAGE_DRIVER (local when unset)
+func Default() (Backend, error) {
+	name := config.LoadEnv().StorageDriver
+	if name == "" {
+		name = LocalBackendName
+	}
+	return Get(name)
+}
+
+func init() {
+	Register(NewLocalBackend())
+	Register(&S3Backend{})
+}
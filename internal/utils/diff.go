@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// FieldChange is one field that differs between two snapshots of an entity
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// DiffFields compares two snapshots by their JSON form and returns the fields whose value changed.
+// Either side may be nil, e.g. for a creation or deletion, then every field of the other side is listed.
+func DiffFields(before, after interface{}) (map[string]FieldChange, error) {
+	from, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]FieldChange)
+	for field, old := range from {
+		if current, ok := to[field]; !ok || !reflect.DeepEqual(old, current) {
+			changes[field] = FieldChange{From: old, To: to[field]}
+		}
+	}
+	for field, current := range to {
+		if _, ok := from[field]; !ok {
+			changes[field] = FieldChange{To: current}
+		}
+	}
+	return changes, nil
+}
+
+func jsonFields(v interface{}) (map[string]interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	// a nil pointer marshals to null and leaves the map empty
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
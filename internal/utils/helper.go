@@ -13,17 +13,23 @@ import (
 
 type UserResponse struct {
 	ID       uuid.UUID `json:"id"`
+	Fullname string    `json:"fullname"`
 	Username string    `json:"username"`
 	Email    string    `json:"email"`
 	Avatar   string    `json:"avatar,omitempty"` // optional
+
+	EmailVerified bool `json:"email_verified"`
 }
 
 func ToUserResponse(user *models.User) UserResponse {
 	return UserResponse{
 		ID:       user.ID,
+		Fullname: user.Fullname,
 		Username: user.Username,
 		Email:    user.Email,
-		//Avatar:   user.AvatarURL,
+
+		EmailVerified: user.EmailVerifiedAt != nil,
+		Avatar:        user.AvatarURL,
 	}
 }
 
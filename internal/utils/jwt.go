@@ -2,24 +2,82 @@ package utils
 
 import (
 	"errors"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
 )
 
 type JWTClaims struct {
 	UserID string   `json:"user_id"`
-	Roles  []string `json:"roles"` // ["user", "admin"]
+	Roles  []string `json:"roles"`         // ["user", "admin"]
+	MFA    bool     `json:"mfa,omitempty"` // the session passed two-factor authentication
+	// IssuedAtMs is iat in milliseconds, iat alone can't tell a revocation from a login in the same second
+	IssuedAtMs int64 `json:"iat_ms,omitempty"`
+	// Actor is set on impersonation tokens: an admin acting as UserID (the RFC 8693 "act" claim)
+	Actor *TokenActor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
+type TokenActor struct {
+	UserID string `json:"sub"`
+}
+
+// Impersonator returns the admin behind an impersonation token, empty for normal tokens
+func (c *JWTClaims) Impersonator() string {
+	if c.Actor == nil {
+		return ""
+	}
+	return c.Actor.UserID
+}
+
+// NewAccessClaims builds the claims of a short-lived access token.
+// Every token gets its own jti so it can be revoked on logout.
+func NewAccessClaims(userID string, roles []string) JWTClaims {
+	now := time.Now()
+	return JWTClaims{
+		UserID:     userID,
+		Roles:      roles,
+		IssuedAtMs: now.UnixMilli(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL())),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "e-commerce-app",
+		},
+	}
+}
+
+func AccessTokenTTL() time.Duration {
+	if settings == nil {
+		return defaultAccessTokenTTL
+	}
+	return settings.accessTokenTTL
+}
+
+func RefreshTokenTTL() time.Duration {
+	if settings == nil {
+		return defaultRefreshTokenTTL
+	}
+	return settings.refreshTokenTTL
+}
+
+// CreateToken signs the claims with the current key, see InitJWT
 func CreateToken(claims JWTClaims) (string, error) {
-	env := config.LoadEnv()
-	secret := []byte(env.JWTSecret)
+	key, err := currentSigningKey(time.Now())
+	if err != nil {
+		return "", err
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.Kid
 
-	tokenString, err := token.SignedString(secret)
+	tokenString, err := token.SignedString(key.Private)
 	if err != nil {
 		return "", err
 	}
@@ -28,15 +86,22 @@ func CreateToken(claims JWTClaims) (string, error) {
 }
 
 func VerifyJWT(tokenString string) (*JWTClaims, error) {
-	env := config.LoadEnv()
-	secret := []byte(env.JWTSecret)
-
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		&JWTClaims{},
 		func(token *jwt.Token) (interface{}, error) {
-			return secret, nil
+			kid, _ := token.Header["kid"].(string)
+			key, err := verificationKey(kid, time.Now())
+			if err != nil {
+				return nil, err
+			}
+			// the header must not pick a different algorithm than the key was made for
+			if token.Method.Alg() != key.Method.Alg() {
+				return nil, errors.New("unexpected signing method")
+			}
+			return key.publicKey(), nil
 		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
 	)
 
 	if err != nil {
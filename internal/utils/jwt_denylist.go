@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Access tokens are stateless, so revoking one means remembering it in Redis until it would expire anyway.
+// Single tokens are denied by jti; "log out everywhere" stores a cutoff and denies every token issued at or before it.
+
+func denylistKey(jti string) string {
+	return "jwt:denylist:" + jti
+}
+
+// the cutoff is in milliseconds
+func revokedBeforeKey(userID string) string {
+	return "jwt:revoked_before_ms:" + userID
+}
+
+// RevokeToken denies this access token until it expires
+func RevokeToken(ctx context.Context, claims *JWTClaims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return errors.New("token has no jti or expiry")
+	}
+	ttl := time.Until(claims.ExpiresAt.Time)
+	if ttl <= 0 {
+		return nil
+	}
+	return config.RDB.Set(ctx, denylistKey(claims.ID), 1, ttl).Err()
+}
+
+// RevokeAllUserTokens denies every access token issued to the user up to now.
+// The cutoff only has to outlive the longest access token.
+func RevokeAllUserTokens(ctx context.Context, userID string) error {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	return config.RDB.Set(ctx, revokedBeforeKey(userID), now, AccessTokenTTL()).Err()
+}
+
+// IsTokenRevoked checks the denylist and the user's revocation cutoff
+func IsTokenRevoked(ctx context.Context, claims *JWTClaims) (bool, error) {
+	if claims.ID != "" {
+		n, err := config.RDB.Exists(ctx, denylistKey(claims.ID)).Result()
+		if err != nil {
+			return false, err
+		}
+		if n > 0 {
+			return true, nil
+		}
+	}
+
+	cutoff, err := config.RDB.Get(ctx, revokedBeforeKey(claims.UserID)).Int64()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if claims.IssuedAtMs != 0 {
+		return claims.IssuedAtMs <= cutoff, nil
+	}
+	// tokens from before iat_ms only have whole seconds, deny the whole second to be safe
+	if claims.IssuedAt == nil {
+		return true, nil
+	}
+	return claims.IssuedAt.UnixMilli() <= cutoff, nil
+}
@@ -0,0 +1,238 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+)
+
+const defaultKeyGracePeriod = 24 * time.Hour
+
+// signingKey is one entry of the key set. A key signs from ActiveFrom until the next key
+// becomes active, and keeps verifying for the grace period after that.
+type signingKey struct {
+	Kid        string
+	Method     jwt.SigningMethod
+	Private    crypto.Signer
+	ActiveFrom time.Time
+	RetireAt   *time.Time // nil for the newest key
+}
+
+func (k *signingKey) publicKey() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+type tokenSettings struct {
+	keys            []*signingKey // sorted by ActiveFrom
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+}
+
+var settings *tokenSettings
+
+// InitJWT loads the signing keys and token lifetimes once at startup.
+//
+// Keys are PKCS#8 PEM files (RSA or Ed25519) in JWT_KEYS_DIR, the file name without
+// extension is the kid. JWT_KEY_SCHEDULE ("kid=RFC3339,kid=RFC3339") says when each key
+// starts signing. A single key may be left out, it's then active from the start; with more
+// than one key every key needs an entry, so the signer never depends on file order. Rotate by adding a new
+// key with a future activation time, and remove the old file after the grace period.
+// Without JWT_KEYS_DIR an ephemeral Ed25519 key is generated, which is only fine for development.
+func InitJWT(env *config.EnvConfig) error {
+	grace := config.DurationOr(env.JWTKeyGracePeriod, defaultKeyGracePeriod)
+
+	var keys []*signingKey
+	if env.JWTKeysDir == "" {
+		log.Println("JWT_KEYS_DIR is not set, using an ephemeral signing key; tokens won't survive a restart")
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		keys = []*signingKey{{Kid: "ephemeral", Method: jwt.SigningMethodEdDSA, Private: priv}}
+	} else {
+		schedule, err := parseKeySchedule(env.JWTKeySchedule)
+		if err != nil {
+			return err
+		}
+		if keys, err = loadSigningKeys(env.JWTKeysDir, schedule); err != nil {
+			return err
+		}
+	}
+
+	// kid breaks ties, so keys activated at the same time always sort the same way
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].ActiveFrom.Equal(keys[j].ActiveFrom) {
+			return keys[i].ActiveFrom.Before(keys[j].ActiveFrom)
+		}
+		return keys[i].Kid < keys[j].Kid
+	})
+	for i := 0; i < len(keys)-1; i++ {
+		retireAt := keys[i+1].ActiveFrom.Add(grace)
+		keys[i].RetireAt = &retireAt
+	}
+
+	settings = &tokenSettings{
+		keys:            keys,
+		accessTokenTTL:  config.DurationOr(env.AccessTokenTTL, defaultAccessTokenTTL),
+		refreshTokenTTL: config.DurationOr(env.RefreshTokenTTL, defaultRefreshTokenTTL),
+	}
+	return nil
+}
+
+func parseKeySchedule(raw string) (map[string]time.Time, error) {
+	schedule := map[string]time.Time{}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, at, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid JWT_KEY_SCHEDULE entry %q", entry)
+		}
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(at))
+		if err != nil {
+			return nil, fmt.Errorf("invalid activation time for key %s: %w", kid, err)
+		}
+		schedule[strings.TrimSpace(kid)] = t
+	}
+	return schedule, nil
+}
+
+func loadSigningKeys(dir string, schedule map[string]time.Time) ([]*signingKey, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no signing keys in %s", dir)
+	}
+
+	keys := make([]*signingKey, 0, len(files))
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode(raw)
+		if block == nil {
+			return nil, fmt.Errorf("%s is not a PEM file", file)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+		activeFrom, scheduled := schedule[kid]
+		if !scheduled && len(files) > 1 {
+			return nil, fmt.Errorf("key %s has no JWT_KEY_SCHEDULE entry, every key needs one when there are several", kid)
+		}
+		key := &signingKey{Kid: kid, ActiveFrom: activeFrom}
+		switch k := parsed.(type) {
+		case *rsa.PrivateKey:
+			key.Method, key.Private = jwt.SigningMethodRS256, k
+		case ed25519.PrivateKey:
+			key.Method, key.Private = jwt.SigningMethodEdDSA, k
+		default:
+			return nil, fmt.Errorf("%s: only RSA and Ed25519 keys are supported", file)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// currentSigningKey is the most recently activated key
+func currentSigningKey(now time.Time) (*signingKey, error) {
+	if settings == nil {
+		return nil, errors.New("signing keys are not loaded")
+	}
+	var current *signingKey
+	for _, k := range settings.keys {
+		if !k.ActiveFrom.After(now) {
+			current = k
+		}
+	}
+	if current == nil {
+		return nil, errors.New("no signing key is active yet")
+	}
+	return current, nil
+}
+
+// verificationKey finds a key that may still verify tokens: already active and not past its grace period
+func verificationKey(kid string, now time.Time) (*signingKey, error) {
+	if settings == nil {
+		return nil, errors.New("signing keys are not loaded")
+	}
+	for _, k := range settings.keys {
+		if k.Kid != kid {
+			continue
+		}
+		if k.ActiveFrom.After(now) || (k.RetireAt != nil && now.After(*k.RetireAt)) {
+			return nil, fmt.Errorf("key %s is not valid now", kid)
+		}
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown key %s", kid)
+}
+
+// PublicJWKS lists the public keys other services may use to verify our tokens,
+// including upcoming keys so they are cached before they start signing
+func PublicJWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	if settings == nil {
+		return set
+	}
+
+	now := time.Now()
+	for _, k := range settings.keys {
+		if k.RetireAt != nil && now.After(*k.RetireAt) {
+			continue
+		}
+		jwk := JWK{Kid: k.Kid, Use: "sig", Alg: k.Method.Alg()}
+		switch pub := k.publicKey().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
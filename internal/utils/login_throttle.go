@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Login throttling keeps failure counters in Redis per email and per client IP.
+// The first few failures are free, after that every attempt has to wait twice as long
+// as the previous one. Too many failures for one email lock that account for a while.
+// An IP gets half its limit for free, so a shared address isn't slowed down by a couple of typos.
+const (
+	defaultLoginMaxFailures   = 5
+	defaultLoginIPMaxFailures = 50
+	defaultLoginLockout       = 15 * time.Minute
+
+	loginFreeFailures = 2
+	loginBackoffBase  = time.Second
+	loginBackoffMax   = 5 * time.Minute
+)
+
+type LoginThrottleDecision int
+
+const (
+	LoginAllowed LoginThrottleDecision = iota
+	LoginBackoff                       // 429, too many attempts right now
+	LoginLocked                        // 423, account temporarily locked
+)
+
+type loginThrottleSettings struct {
+	maxFailures    int64
+	ipMaxFailures  int64
+	ipFreeFailures int64
+	lockout        time.Duration
+}
+
+var (
+	throttleOnce     sync.Once
+	throttleSettings loginThrottleSettings
+)
+
+func loginThrottle() loginThrottleSettings {
+	throttleOnce.Do(func() {
+		env := config.LoadEnv()
+		throttleSettings = loginThrottleSettings{
+			maxFailures:   intOr(env.LoginMaxFailures, defaultLoginMaxFailures),
+			ipMaxFailures: intOr(env.LoginIPMaxFailures, defaultLoginIPMaxFailures),
+			lockout:       config.DurationOr(env.LoginLockoutDuration, defaultLoginLockout),
+		}
+		throttleSettings.ipFreeFailures = max(throttleSettings.ipMaxFailures/2, loginFreeFailures)
+	})
+	return throttleSettings
+}
+
+func intOr(raw string, fallback int64) int64 {
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n < 1 {
+		return fallback
+	}
+	return n
+}
+
+func normalizeLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func loginFailKey(scope string, id string) string { return "login:fail:" + scope + ":" + id }
+func loginWaitKey(scope string, id string) string { return "login:wait:" + scope + ":" + id }
+func loginLockKey(email string) string            { return "login:lock:email:" + email }
+
+// reserveLoginAttempt checks the limits and counts the attempt as a failure in one step,
+// so parallel requests can't all pass the check before any of them is counted.
+// KEYS: lock, email failures, email wait, ip failures, ip wait
+// ARGV: max failures, ip max failures, window, email free failures, backoff base, backoff max (ms), ip free failures
+// Returns {decision, wait in ms}.
+var reserveLoginAttempt = redis.NewScript(`
+local lock = redis.call('PTTL', KEYS[1])
+if lock > 0 then
+	return {2, lock}
+end
+
+local wait = math.max(redis.call('PTTL', KEYS[3]), redis.call('PTTL', KEYS[5]))
+if wait > 0 then
+	return {1, wait}
+end
+
+local limits = {{KEYS[2], tonumber(ARGV[1])}, {KEYS[4], tonumber(ARGV[2])}}
+for _, limit in ipairs(limits) do
+	if tonumber(redis.call('GET', limit[1]) or '0') >= limit[2] then
+		local ttl = redis.call('PTTL', limit[1])
+		if ttl <= 0 then
+			ttl = tonumber(ARGV[3])
+		end
+		return {1, ttl}
+	end
+end
+
+local function reserve(failKey, waitKey, free)
+	local failures = redis.call('INCR', failKey)
+	if failures == 1 then
+		redis.call('PEXPIRE', failKey, ARGV[3])
+	end
+	if failures > free then
+		local backoff = tonumber(ARGV[5]) * 2 ^ math.min(failures - free - 1, 16)
+		redis.call('SET', waitKey, 1, 'PX', math.floor(math.min(backoff, tonumber(ARGV[6]))))
+	end
+end
+reserve(KEYS[2], KEYS[3], tonumber(ARGV[4]))
+reserve(KEYS[4], KEYS[5], tonumber(ARGV[7]))
+return {0, 0}
+`)
+
+// releaseLoginAttempt takes a reserved attempt back off the failure counters in KEYS
+var releaseLoginAttempt = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	if tonumber(redis.call('GET', key) or '0') > 0 then
+		redis.call('DECR', key)
+	end
+end
+return 0
+`)
+
+// ReserveLoginAttempt says whether a login attempt may go ahead, and if not how long to wait.
+// An allowed attempt is counted as a failure right away; ResetLoginFailures takes it back on success.
+func ReserveLoginAttempt(ctx context.Context, email string, ip string) (LoginThrottleDecision, time.Duration, error) {
+	email = normalizeLoginEmail(email)
+	settings := loginThrottle()
+
+	res, err := reserveLoginAttempt.Run(ctx, config.RDB,
+		[]string{
+			loginLockKey(email),
+			loginFailKey("email", email), loginWaitKey("email", email),
+			loginFailKey("ip", ip), loginWaitKey("ip", ip),
+		},
+		settings.maxFailures, settings.ipMaxFailures, settings.lockout.Milliseconds(),
+		loginFreeFailures, loginBackoffBase.Milliseconds(), loginBackoffMax.Milliseconds(),
+		settings.ipFreeFailures,
+	).Int64Slice()
+	if err != nil {
+		return LoginAllowed, 0, err
+	}
+	return LoginThrottleDecision(res[0]), time.Duration(res[1]) * time.Millisecond, nil
+}
+
+// RecordLoginFailure settles a failed attempt, it was already counted when it was reserved.
+// It reports whether this failure locked the account.
+func RecordLoginFailure(ctx context.Context, email string) (bool, error) {
+	email = normalizeLoginEmail(email)
+	settings := loginThrottle()
+
+	failures, err := config.RDB.Get(ctx, loginFailKey("email", email)).Int64()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if failures < settings.maxFailures {
+		return false, nil
+	}
+
+	locked, err := config.RDB.SetNX(ctx, loginLockKey(email), 1, settings.lockout).Result()
+	if err != nil || !locked {
+		return false, err
+	}
+	return true, config.RDB.Del(ctx, loginFailKey("email", email), loginWaitKey("email", email)).Err()
+}
+
+// ResetLoginFailures clears the email's counters and the IP's wait after a successful login.
+// The IP counter only gives back this attempt, so one good account doesn't unlock guessing others.
+func ResetLoginFailures(ctx context.Context, email string, ip string) error {
+	email = normalizeLoginEmail(email)
+	if err := config.RDB.Del(ctx, loginFailKey("email", email), loginWaitKey("email", email), loginWaitKey("ip", ip)).Err(); err != nil {
+		return err
+	}
+	return releaseLoginAttempt.Run(ctx, config.RDB, []string{loginFailKey("ip", ip)}).Err()
+}
+
+// ReleaseLoginAttempt gives back a reserved attempt that ended without checking the password,
+// e.g. on a database error, so it doesn't count as a failure.
+func ReleaseLoginAttempt(ctx context.Context, email string, ip string) error {
+	email = normalizeLoginEmail(email)
+	return releaseLoginAttempt.Run(ctx, config.RDB, []string{loginFailKey("email", email), loginFailKey("ip", ip)}).Err()
+}
+
+// UnlockLogin lifts a lockout and clears the email's counters
+func UnlockLogin(ctx context.Context, email string) error {
+	email = normalizeLoginEmail(email)
+	return config.RDB.Del(ctx, loginLockKey(email), loginFailKey("email", email), loginWaitKey("email", email)).Err()
+}
+
+// LoginLockoutDuration is how long an account stays locked
+func LoginLockoutDuration() time.Duration {
+	return loginThrottle().lockout
+}
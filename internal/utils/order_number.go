@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goutamkumar/golang_restapi_postgresql_test1/internal/config"
+)
+
+// OrderNumberFormat controls how order numbers look, e.g. ORD-20260114-000042-4
+// (prefix, date, zero padded sequence, check digit).
+type OrderNumberFormat struct {
+	Prefix     string
+	DateLayout string // Go time layout
+	SeqDigits  int
+}
+
+// orderNumberMaxLen is the size of orders.order_number
+const orderNumberMaxLen = 30
+
+var (
+	orderNumberFormat     OrderNumberFormat
+	orderNumberFormatOnce sync.Once
+)
+
+// GetOrderNumberFormat reads the store's format from env once
+// (ORDER_NUMBER_PREFIX, ORDER_NUMBER_DATE_LAYOUT, ORDER_NUMBER_SEQ_DIGITS).
+func GetOrderNumberFormat() OrderNumberFormat {
+	orderNumberFormatOnce.Do(func() {
+		env := config.LoadEnv()
+		orderNumberFormat = OrderNumberFormat{
+			Prefix:     "ORD",
+			DateLayout: "20060102",
+			SeqDigits:  6,
+		}
+		if env.OrderNumberPrefix != "" {
+			orderNumberFormat.Prefix = strings.ToUpper(env.OrderNumberPrefix)
+		}
+		if env.OrderNumberDateLayout != "" {
+			orderNumberFormat.DateLayout = env.OrderNumberDateLayout
+		}
+		if n, err := strconv.Atoi(env.OrderNumberSeqDigits); err == nil && n > 0 {
+			orderNumberFormat.SeqDigits = n
+		}
+	})
+	return orderNumberFormat
+}
+
+// FormatOrderNumber builds the order number for a sequence value.
+// Uniqueness comes from the sequence, the date only makes the number readable and sortable.
+func FormatOrderNumber(f OrderNumberFormat, at time.Time, seq int64) string {
+	date := at.UTC().Format(f.DateLayout)
+	body := fmt.Sprintf("%s%0*d", date, f.SeqDigits, seq)
+	check := luhnCheckDigit(body)
+
+	number := fmt.Sprintf("%s-%0*d-%d", date, f.SeqDigits, seq, check)
+	if f.Prefix != "" {
+		number = f.Prefix + "-" + number
+	}
+	return number
+}
+
+// ValidateOrderNumberFormat checks that the longest number the format produces
+// still fits the orders.order_number column.
+func ValidateOrderNumberFormat(f OrderNumberFormat) error {
+	if f.SeqDigits > 18 {
+		return fmt.Errorf("order number sequence can't have more than 18 digits, got %d", f.SeqDigits)
+	}
+	// the longest month and weekday names, so text layouts are measured at their widest
+	widest := time.Date(2026, time.September, 30, 23, 59, 59, 999999999, time.UTC)
+	sample := FormatOrderNumber(f, widest, 0)
+	if len(sample) > orderNumberMaxLen {
+		return fmt.Errorf("order numbers like %q are longer than %d characters", sample, orderNumberMaxLen)
+	}
+	return nil
+}
+
+// luhnCheckDigit returns the Luhn (mod 10) check digit for a string of digits.
+// Non-digit characters are skipped.
+func luhnCheckDigit(digits string) int {
+	sum := 0
+	double := true
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if d < 0 || d > 9 {
+			continue
+		}
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return (10 - sum%10) % 10
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidPostalCode = errors.New("invalid postal code")
+
+// postalCodeFormats covers the countries we ship to most. Codes are matched after
+// NormalizePostalCode, so patterns only need upper case and single spaces.
+var postalCodeFormats = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^\d{4}$`),
+	"AU": regexp.MustCompile(`^\d{4}$`),
+	"BD": regexp.MustCompile(`^\d{4}$`),
+	"BE": regexp.MustCompile(`^\d{4}$`),
+	"BR": regexp.MustCompile(`^\d{5}-?\d{3}$`),
+	"CA": regexp.MustCompile(`^[ABCEGHJ-NPRSTVXY]\d[ABCEGHJ-NPRSTV-Z] ?\d[ABCEGHJ-NPRSTV-Z]\d$`),
+	"CH": regexp.MustCompile(`^\d{4}$`),
+	"CN": regexp.MustCompile(`^\d{6}$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+	"DK": regexp.MustCompile(`^\d{4}$`),
+	"ES": regexp.MustCompile(`^\d{5}$`),
+	"FI": regexp.MustCompile(`^\d{5}$`),
+	"FR": regexp.MustCompile(`^\d{5}$`),
+	"GB": regexp.MustCompile(`^([A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}|GIR ?0AA)$`),
+	"IN": regexp.MustCompile(`^[1-9]\d{2} ?\d{3}$`),
+	"IT": regexp.MustCompile(`^\d{5}$`),
+	"JP": regexp.MustCompile(`^\d{3}-?\d{4}$`),
+	"MX": regexp.MustCompile(`^\d{5}$`),
+	"NL": regexp.MustCompile(`^\d{4} ?[A-Z]{2}$`),
+	"NO": regexp.MustCompile(`^\d{4}$`),
+	"PK": regexp.MustCompile(`^\d{5}$`),
+	"PL": regexp.MustCompile(`^\d{2}-\d{3}$`),
+	"PT": regexp.MustCompile(`^\d{4}-\d{3}$`),
+	"SE": regexp.MustCompile(`^\d{3} ?\d{2}$`),
+	"SG": regexp.MustCompile(`^\d{6}$`),
+	"US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+}
+
+// countriesWithoutPostalCodes may leave the postal code empty
+var countriesWithoutPostalCodes = map[string]bool{
+	"AE": true,
+	"HK": true,
+	"IE": true, // Eircodes exist but many addresses are written without one
+	"QA": true,
+}
+
+// anyPostalCode is the sanity check for countries without a known format
+var anyPostalCode = regexp.MustCompile(`^[A-Z0-9][A-Z0-9 -]{1,9}$`)
+
+func NormalizePostalCode(code string) string {
+	return strings.Join(strings.Fields(strings.ToUpper(code)), " ")
+}
+
+// ValidatePostalCode checks an already normalized code against the country's format
+func ValidatePostalCode(country string, code string) error {
+	country = strings.ToUpper(country)
+	if code == "" {
+		if countriesWithoutPostalCodes[country] {
+			return nil
+		}
+		return fmt.Errorf("%w: required for %s", ErrInvalidPostalCode, country)
+	}
+
+	format, ok := postalCodeFormats[country]
+	if !ok {
+		format = anyPostalCode
+	}
+	if !format.MatchString(code) {
+		return fmt.Errorf("%w: %q is not a valid %s postal code", ErrInvalidPostalCode, code, country)
+	}
+	return nil
+}
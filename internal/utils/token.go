@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// GenerateOpaqueToken returns a random URL-safe token and the hash to store for it
+func GenerateOpaqueToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken is a plain SHA-256: the tokens are random, so no salt or slow hash is needed
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+const apiKeyPrefix = "ak_"
+
+// GenerateAPIKey returns a new key, the part of it that's safe to display, and the hash to store.
+// Keys look like ak_<8 char id>_<secret>.
+func GenerateAPIKey() (string, string, string, error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", "", err
+	}
+	secret, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	prefix := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(id)
+	key := prefix + "_" + secret
+	return key, prefix, HashToken(key), nil
+}
@@ -0,0 +1,11 @@
+-- Order statuses added with the status transitions.
+-- GORM doesn't manage enum types, so existing databases need the new values added by hand.
+DO $$ BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'order_status') THEN
+		CREATE TYPE order_status AS ENUM ('pending', 'paid', 'shipped', 'cancelled');
+	END IF;
+END $$;
+
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'processing' AFTER 'paid';
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'delivered' AFTER 'shipped';
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'refunded' AFTER 'cancelled';
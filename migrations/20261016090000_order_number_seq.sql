@@ -0,0 +1,2 @@
+-- Order numbers are built from this sequence, see repository.NextOrderNumberSequence.
+CREATE SEQUENCE IF NOT EXISTS order_number_seq;